@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/getmicah/myapp-api/spotify"
+)
+
+type sessionKey struct{}
+
+// Auth : middleware resolving the request's session once and putting it in the context
+type Auth struct {
+	sessionCookie CookieID
+	sessions      SessionStore
+	clientID      string
+	clientSecret  string
+	api           *spotify.Client
+}
+
+// Require : reject requests without a valid session, otherwise load the
+// session (refreshing its token) and the Spotify user into the context
+func (a *Auth) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := LoadSession(r, a.sessions, a.sessionCookie, a.clientID, a.clientSecret)
+		if err != nil {
+			SendProblem(w, AuthProblem(err, CodeAuthExpired))
+			return
+		}
+		// sessions started before the user (or their country) was stored look it up once
+		if session.User.ID == "" || (session.User.Country == "" && HasScopes(session.Scopes, Features["profile"])) {
+			me, err := a.api.Me(r.Context(), session.Token.AccessToken)
+			if err != nil {
+				SendSpotifyError(w, err)
+				return
+			}
+			session.User = *me
+			id, _ := ReadCookie(r, a.sessionCookie)
+			if err := a.sessions.Save(r.Context(), id, session, SessionLifetime); err != nil {
+				SendError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+				return
+			}
+			SetLogUser(r.Context(), session.User.ID)
+		}
+		ctx := context.WithValue(r.Context(), sessionKey{}, session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireFunc : Require for a handler function
+func (a *Auth) RequireFunc(f http.HandlerFunc) http.Handler {
+	return a.Require(f)
+}
+
+// AuthProblem : problem for a failed login or session load. Missing sessions are
+// unauthenticated, tokens Spotify's accounts service refuses are reported as code.
+func AuthProblem(err error, code string) Problem {
+	if errors.Is(err, ErrSessionNotFound) {
+		return NewProblem(http.StatusUnauthorized, CodeUnauthenticated, "Not logged in")
+	}
+	var spErr *spotify.Error
+	if !errors.As(err, &spErr) {
+		var netErr net.Error
+		if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+			return SpotifyProblem(err)
+		}
+		return NewProblem(http.StatusInternalServerError, CodeInternal, err.Error())
+	}
+	p := SpotifyProblem(err)
+	if spErr.Status == http.StatusBadRequest || spErr.Status == http.StatusUnauthorized {
+		p.Status = http.StatusUnauthorized
+		p.Title = http.StatusText(p.Status)
+		p.Code = code
+		p.Detail = "Spotify rejected the authorization (" + spErr.Error() + "), log in again"
+	}
+	return p
+}
+
+// CurrentSession : session loaded by Auth.Require
+func CurrentSession(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
+
+// AccessToken : access token of the session loaded by Auth.Require
+func AccessToken(ctx context.Context) string {
+	if s := CurrentSession(ctx); s != nil {
+		return s.Token.AccessToken
+	}
+	return ""
+}
+
+// CurrentUser : Spotify user of the session loaded by Auth.Require
+func CurrentUser(ctx context.Context) *spotify.User {
+	if s := CurrentSession(ctx); s != nil {
+		return &s.User
+	}
+	return nil
+}
+
+// RequestMarket : market to query Spotify with. An explicit ?market= country code
+// or from_token wins, then the logged in user's country, then def.
+func RequestMarket(r *http.Request, def string) (string, error) {
+	if m := r.URL.Query().Get("market"); m != "" {
+		if m == spotify.MarketFromToken {
+			return m, nil
+		}
+		if len(m) != 2 {
+			return "", fmt.Errorf("market must be a 2 letter country code or %s", spotify.MarketFromToken)
+		}
+		return strings.ToUpper(m), nil
+	}
+	if u := CurrentUser(r.Context()); u != nil && u.Country != "" {
+		return u.Country, nil
+	}
+	return def, nil
+}
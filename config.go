@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	// DefaultConfigPath : config file read when neither -config nor REC_API_CONFIG is set
+	DefaultConfigPath = "./config.json"
+	// envPrefix : prefix of environment variables overriding config settings
+	envPrefix = "REC_API_"
+)
+
+type config struct {
+	APIURL           string      `json:"apiURL"`
+	AppURL           string      `json:"appURL"`
+	RedirectURI      string      `json:"redirectURI"`
+	SpotifyURL       string      `json:"spotifyURL"`
+	ClientID         string      `json:"clientID"`
+	ClientSecret     string      `json:"clientSecret"`
+	ListenAddr       string      `json:"listenAddr"`
+	TLSCert          string      `json:"tlsCert"`
+	TLSKey           string      `json:"tlsKey"`
+	RedirectAddr     string      `json:"redirectAddr"`
+	MetricsAddr      string      `json:"metricsAddr"`
+	ACME             bool        `json:"acme"`
+	ACMEDirectoryURL string      `json:"acmeDirectoryURL"`
+	ACMECARoot       string      `json:"acmeCARoot"`
+	ACMECacheDir     string      `json:"acmeCacheDir"`
+	ACMEEmail        string      `json:"acmeEmail"`
+	ACMEHosts        []string    `json:"acmeHosts"`
+	ClientTimeout    Duration    `json:"clientTimeout"`
+	ReadTimeout      Duration    `json:"readTimeout"`
+	WriteTimeout     Duration    `json:"writeTimeout"`
+	IdleTimeout      Duration    `json:"idleTimeout"`
+	ShutdownTimeout  Duration    `json:"shutdownTimeout"`
+	Market           string      `json:"market"`
+	SearchLimit      int         `json:"searchLimit"`
+	RecLimit         int         `json:"recLimit"`
+	GenresTTL        Duration    `json:"genresTTL"`
+	CookieKeys       []CookieKey `json:"cookieKeys"`
+	CookieKeyFile    string      `json:"cookieKeyFile"`
+	SessionStore     string      `json:"sessionStore"`
+	SessionPath      string      `json:"sessionPath"`
+	RedisURL         string      `json:"redisURL"`
+	ReadyProbe       bool        `json:"readyProbe"`
+	ReadyProbeTTL    Duration    `json:"readyProbeTTL"`
+	OTLPEndpoint     string      `json:"otlpEndpoint"`
+	ServiceName      string      `json:"serviceName"`
+	LogFormat        string      `json:"logFormat"`
+	LogLevel         string      `json:"logLevel"`
+	PKCE             bool        `json:"pkce"`
+	Production       bool        `json:"production"`
+}
+
+// Duration : time.Duration written as a string like "10s" in config files
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON : implement json.Unmarshaler
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// MarshalJSON : implement json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// setting : config value that can be overridden by an environment variable and a flag
+type setting struct {
+	name   string
+	env    string
+	usage  string
+	set    func(string) error
+	isBool bool
+}
+
+func (c *config) settings() []setting {
+	str := func(name, env, usage string, p *string) setting {
+		return setting{name, env, usage, func(v string) error { *p = v; return nil }, false}
+	}
+	num := func(name, env, usage string, p *int) setting {
+		return setting{name, env, usage, func(v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return err
+			}
+			*p = n
+			return nil
+		}, false}
+	}
+	boolean := func(name, env, usage string, p *bool) setting {
+		return setting{name, env, usage, func(v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			*p = b
+			return nil
+		}, true}
+	}
+	list := func(name, env, usage string, p *[]string) setting {
+		return setting{name, env, usage, func(v string) error {
+			*p = nil
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*p = append(*p, item)
+				}
+			}
+			return nil
+		}, false}
+	}
+	duration := func(name, env, usage string, p *Duration) setting {
+		return setting{name, env, usage, func(v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err
+			}
+			p.Duration = d
+			return nil
+		}, false}
+	}
+	return []setting{
+		str("apiURL", envPrefix+"API_URL", "public url of this api", &c.APIURL),
+		str("appURL", envPrefix+"APP_URL", "url of the frontend, allowed by CORS", &c.AppURL),
+		str("redirectURI", envPrefix+"REDIRECT_URI", "spotify oauth redirect uri", &c.RedirectURI),
+		str("spotifyURL", envPrefix+"SPOTIFY_URL", "spotify web api base url", &c.SpotifyURL),
+		str("clientID", "SPOTIFY_CLIENT_ID", "spotify client id", &c.ClientID),
+		str("clientSecret", "SPOTIFY_CLIENT_SECRET", "spotify client secret", &c.ClientSecret),
+		str("listenAddr", envPrefix+"LISTEN_ADDR", "address to listen on", &c.ListenAddr),
+		str("tlsCert", envPrefix+"TLS_CERT", "tls certificate chain (production)", &c.TLSCert),
+		str("tlsKey", envPrefix+"TLS_KEY", "tls private key (production)", &c.TLSKey),
+		str("redirectAddr", envPrefix+"REDIRECT_ADDR", "http to https redirect address (production)", &c.RedirectAddr),
+		str("metricsAddr", envPrefix+"METRICS_ADDR", "internal address serving /metrics over plain http (empty disables metrics)", &c.MetricsAddr),
+		boolean("acme", envPrefix+"ACME", "obtain certificates from an ACME directory", &c.ACME),
+		str("acmeDirectoryURL", envPrefix+"ACME_DIRECTORY_URL", "ACME directory", &c.ACMEDirectoryURL),
+		str("acmeCARoot", envPrefix+"ACME_CA_ROOT", "extra root certificate trusted for the ACME directory", &c.ACMECARoot),
+		str("acmeCacheDir", envPrefix+"ACME_CACHE_DIR", "directory certificates are cached in", &c.ACMECacheDir),
+		str("acmeEmail", envPrefix+"ACME_EMAIL", "ACME account contact", &c.ACMEEmail),
+		list("acmeHosts", envPrefix+"ACME_HOSTS", "comma separated hosts to obtain certificates for (default apiURL host)", &c.ACMEHosts),
+		duration("clientTimeout", envPrefix+"CLIENT_TIMEOUT", "timeout for spotify requests", &c.ClientTimeout),
+		duration("readTimeout", envPrefix+"READ_TIMEOUT", "timeout for reading requests", &c.ReadTimeout),
+		duration("writeTimeout", envPrefix+"WRITE_TIMEOUT", "timeout for writing responses", &c.WriteTimeout),
+		duration("idleTimeout", envPrefix+"IDLE_TIMEOUT", "keep-alive timeout", &c.IdleTimeout),
+		duration("shutdownTimeout", envPrefix+"SHUTDOWN_TIMEOUT", "time to drain requests on shutdown", &c.ShutdownTimeout),
+		str("market", envPrefix+"MARKET", "spotify market used when the user's country is unknown", &c.Market),
+		num("searchLimit", envPrefix+"SEARCH_LIMIT", "default results per search page", &c.SearchLimit),
+		num("recLimit", envPrefix+"REC_LIMIT", "default tracks per recommendation", &c.RecLimit),
+		duration("genresTTL", envPrefix+"GENRES_TTL", "how long Spotify's genre seeds are cached", &c.GenresTTL),
+		str("cookieKeyFile", envPrefix+"COOKIE_KEY_FILE", "cookie key file", &c.CookieKeyFile),
+		str("sessionStore", envPrefix+"SESSION_STORE", "memory, bolt or redis", &c.SessionStore),
+		str("sessionPath", envPrefix+"SESSION_PATH", "bolt session database", &c.SessionPath),
+		str("redisURL", envPrefix+"REDIS_URL", "redis session store url", &c.RedisURL),
+		boolean("readyProbe", envPrefix+"READY_PROBE", "check Spotify is reachable in /readyz", &c.ReadyProbe),
+		duration("readyProbeTTL", envPrefix+"READY_PROBE_TTL", "how long a Spotify probe result is reused", &c.ReadyProbeTTL),
+		str("otlpEndpoint", envPrefix+"OTLP_ENDPOINT", "OTLP/HTTP trace collector url, e.g. http://localhost:4318 (empty disables tracing)", &c.OTLPEndpoint),
+		str("serviceName", envPrefix+"SERVICE_NAME", "service name reported in traces", &c.ServiceName),
+		str("logFormat", envPrefix+"LOG_FORMAT", "text or json", &c.LogFormat),
+		str("logLevel", envPrefix+"LOG_LEVEL", "debug, info, warn or error", &c.LogLevel),
+		boolean("pkce", envPrefix+"PKCE", "use PKCE instead of the client secret", &c.PKCE),
+		boolean("production", envPrefix+"PRODUCTION", "serve over tls", &c.Production),
+	}
+}
+
+func defaultConfig() config {
+	return config{
+		RedirectAddr:     ":80",
+		ACMEDirectoryURL: acme.LetsEncryptURL,
+		ACMECacheDir:     "./certs",
+		ClientTimeout:    Duration{ClientTimeout},
+		ReadTimeout:      Duration{10 * time.Second},
+		WriteTimeout:     Duration{60 * time.Second},
+		IdleTimeout:      Duration{120 * time.Second},
+		ShutdownTimeout:  Duration{30 * time.Second},
+		Market:           "US",
+		SearchLimit:      5,
+		RecLimit:         30,
+		GenresTTL:        Duration{24 * time.Hour},
+		ReadyProbeTTL:    Duration{30 * time.Second},
+		ServiceName:      "spotify-rec-api",
+		LogFormat:        "text",
+		LogLevel:         "info",
+	}
+}
+
+// LoadConfig : build config from defaults, the config file, environment variables
+// and command-line flags, each layer overriding the one before
+func LoadConfig(args []string) (config, error) {
+	c := defaultConfig()
+	settings := c.settings()
+
+	// flags are parsed first to find the config file, but applied last
+	fs := flag.NewFlagSet("myapp-api", flag.ContinueOnError)
+	path := fs.String("config", "", "config file (env "+envPrefix+"CONFIG, default "+DefaultConfigPath+")")
+	flags := make(map[string]string)
+	for _, s := range settings {
+		name := s.name
+		usage := fmt.Sprintf("%s (env %s)", s.usage, s.env)
+		value := func(v string) error {
+			flags[name] = v
+			return nil
+		}
+		if s.isBool {
+			fs.BoolFunc(name, usage, value)
+		} else {
+			fs.Func(name, usage, value)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+
+	// file
+	if *path == "" {
+		*path = os.Getenv(envPrefix + "CONFIG")
+	}
+	if *path == "" {
+		*path = DefaultConfigPath
+	}
+	file, err := ioutil.ReadFile(*path)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(file, &c); err != nil {
+		return c, fmt.Errorf("%s: %v", *path, err)
+	}
+
+	// environment, then flags
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok && v != "" {
+			if err := s.set(v); err != nil {
+				return c, fmt.Errorf("%s: %v", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := flags[s.name]; ok {
+			if err := s.set(v); err != nil {
+				return c, fmt.Errorf("-%s: %v", s.name, err)
+			}
+		}
+	}
+
+	if c.ListenAddr == "" {
+		c.ListenAddr = ":3000"
+		if c.Production {
+			c.ListenAddr = ":443"
+		}
+	}
+	return c, c.validate()
+}
+
+// validate : report every missing or invalid setting at once
+func (c config) validate() error {
+	var problems []string
+	required := func(name string, env string, v string) {
+		if v == "" {
+			problems = append(problems, fmt.Sprintf("%s is required (env %s)", name, env))
+		}
+	}
+	absURL := func(name string, v string) {
+		if v == "" {
+			return
+		}
+		if u, err := url.Parse(v); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("%s must be an absolute url, got %q", name, v))
+		}
+	}
+	required("clientID", "SPOTIFY_CLIENT_ID", c.ClientID)
+	if !c.PKCE {
+		required("clientSecret", "SPOTIFY_CLIENT_SECRET", c.ClientSecret)
+	}
+	required("apiURL", envPrefix+"API_URL", c.APIURL)
+	required("appURL", envPrefix+"APP_URL", c.AppURL)
+	required("redirectURI", envPrefix+"REDIRECT_URI", c.RedirectURI)
+	absURL("apiURL", c.APIURL)
+	absURL("appURL", c.AppURL)
+	absURL("redirectURI", c.RedirectURI)
+	absURL("spotifyURL", c.SpotifyURL)
+	absURL("otlpEndpoint", c.OTLPEndpoint)
+	if c.Production && c.ACME {
+		required("acmeCacheDir", envPrefix+"ACME_CACHE_DIR", c.ACMECacheDir)
+		absURL("acmeDirectoryURL", c.ACMEDirectoryURL)
+	} else if c.Production {
+		required("tlsCert", envPrefix+"TLS_CERT", c.TLSCert)
+		required("tlsKey", envPrefix+"TLS_KEY", c.TLSKey)
+	}
+	positive := func(name string, d Duration) {
+		if d.Duration <= 0 {
+			problems = append(problems, name+" must be positive")
+		}
+	}
+	positive("clientTimeout", c.ClientTimeout)
+	positive("readTimeout", c.ReadTimeout)
+	positive("writeTimeout", c.WriteTimeout)
+	positive("idleTimeout", c.IdleTimeout)
+	positive("shutdownTimeout", c.ShutdownTimeout)
+	positive("readyProbeTTL", c.ReadyProbeTTL)
+	positive("genresTTL", c.GenresTTL)
+	if len(c.Market) != 2 {
+		problems = append(problems, fmt.Sprintf("market must be a 2 letter country code, got %q", c.Market))
+	}
+	if c.SearchLimit < 1 || c.SearchLimit > 50 {
+		problems = append(problems, "searchLimit must be between 1 and 50")
+	}
+	if c.RecLimit < 1 || c.RecLimit > 100 {
+		problems = append(problems, "recLimit must be between 1 and 100")
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid config:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -2,96 +2,72 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/getmicah/myapp-api/spotify"
 )
 
-// SendError : send an error response back the the user
-func SendError(w http.ResponseWriter, code int, message string) {
-	var e ErrorResponse
-	e.Code = code
-	e.Message = message
-	body, err := json.Marshal(e)
+// httpClient : pooled client shared by every outbound Spotify request
+var httpClient = &http.Client{
+	Timeout: ClientTimeout,
+	Transport: &LogTransport{
+		Base: &TracingTransport{
+			Base: &spotify.Transport{
+				Base:   &MetricsTransport{Base: http.DefaultTransport},
+				Policy: spotify.DefaultRetryPolicy,
+				OnRetry: func(req *http.Request, res *http.Response, err error) {
+					countRetry(req, res, err)
+					traceRetry(req, res, err)
+				},
+			},
+		},
+	},
+}
+
+// SendJSON : send a json response back to the user
+func SendJSON(w http.ResponseWriter, code int, v interface{}) {
+	body, err := json.Marshal(v)
 	if err != nil {
-		SendError(w, http.StatusInternalServerError, err.Error())
+		SendError(w, http.StatusInternalServerError, CodeInternal, err.Error())
 		return
 	}
-	w.WriteHeader(e.Code)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	w.Write(body)
 }
 
-// SendBadRequest : send a method error
-func SendBadRequest(w http.ResponseWriter, method string) {
-	msg := fmt.Sprintf("Endpoint doesn't support %s request", method)
-	SendError(w, http.StatusBadRequest, msg)
-}
-
-// SpotifyGet : make a GET request to Spotify API
-func SpotifyGet(r *http.Request, endpoint string, accessToken string) (*http.Response, error) {
-	client := &http.Client{Timeout: ClientTimeout}
-	u := fmt.Sprintf("https://api.spotify.com/v1%s", endpoint)
-	req, err := http.NewRequest("GET", u, nil)
-	if err != nil {
-		return nil, errors.New("Invalid access_token")
-	}
-	bearer := fmt.Sprintf("Bearer %s", accessToken)
-	req.Header.Set("Authorization", bearer)
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if res.StatusCode != http.StatusOK {
-		return nil, errors.New(res.Status)
-	}
-	return res, nil
-}
-
-// SpotifyPost : make a POST request to Spotify API
-func SpotifyPost(r *http.Request, endpoint string, body io.Reader, accessToken string) (*http.Response, error) {
-	client := &http.Client{Timeout: ClientTimeout}
-	u := fmt.Sprintf("https://api.spotify.com/v1%s", endpoint)
-	req, err := http.NewRequest("POST", u, body)
-	if err != nil {
-		return nil, err
-	}
-	bearer := fmt.Sprintf("Bearer %s", accessToken)
-	req.Header.Set("Authorization", bearer)
-	req.Header.Add("Content-Type", "application/json")
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if !(res.StatusCode == http.StatusOK || res.StatusCode == http.StatusCreated) {
-		return nil, errors.New(res.Status)
-	}
-	return res, nil
-}
-
-// SpotifyAuthPost : make a POST request to Spotify accounts API and receive a token
+// SpotifyAuthPost : make a POST request to Spotify accounts API and receive a token,
+// without a client secret the client id is sent in the body as a public (PKCE) client
 func SpotifyAuthPost(r *http.Request, body url.Values, clientID string, clientSecret string) (*Token, error) {
-	client := &http.Client{Timeout: ClientTimeout}
 	u := "https://accounts.spotify.com/api/token"
-	req, err := http.NewRequest("POST", u, bytes.NewBufferString(body.Encode()))
+	if clientSecret == "" {
+		body.Set("client_id", clientID)
+	}
+	req, err := http.NewRequestWithContext(r.Context(), "POST", u, bytes.NewBufferString(body.Encode()))
 	if err != nil {
 		return nil, err
 	}
-	bearer := fmt.Sprintf("%s:%s", clientID, clientSecret)
-	secret := base64.StdEncoding.EncodeToString([]byte(bearer))
-	req.Header.Add("Authorization", fmt.Sprintf("Basic %s", secret))
+	if clientSecret != "" {
+		bearer := fmt.Sprintf("%s:%s", clientID, clientSecret)
+		secret := base64.StdEncoding.EncodeToString([]byte(bearer))
+		req.Header.Add("Authorization", fmt.Sprintf("Basic %s", secret))
+	}
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	res, err := client.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return nil, errors.New(res.Status)
+		return nil, spotify.ErrorFromResponse(res)
 	}
 	var tr Token
 	if err := json.NewDecoder(res.Body).Decode(&tr); err != nil {
@@ -100,12 +76,26 @@ func SpotifyAuthPost(r *http.Request, body url.Values, clientID string, clientSe
 	return &tr, nil
 }
 
-// RequestOAuthToken : ask Spotify for an oauth token
-func RequestOAuthToken(r *http.Request, code string, redirectURI string, clientID string, clientSecret string) (*Token, error) {
+// NewCodeVerifier : create a random PKCE code verifier
+func NewCodeVerifier() string {
+	return base64.RawURLEncoding.EncodeToString(GenerateRandomBytes(48))
+}
+
+// CodeChallenge : S256 PKCE code challenge for verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RequestOAuthToken : ask Spotify for an oauth token, verifier is only sent when using PKCE
+func RequestOAuthToken(r *http.Request, code string, verifier string, redirectURI string, clientID string, clientSecret string) (*Token, error) {
 	body := url.Values{}
 	body.Set("grant_type", "authorization_code")
 	body.Set("code", code)
 	body.Set("redirect_uri", redirectURI)
+	if verifier != "" {
+		body.Set("code_verifier", verifier)
+	}
 	token, err := SpotifyAuthPost(r, body, clientID, clientSecret)
 	if err != nil {
 		return nil, err
@@ -125,39 +115,50 @@ func RequestNewOAuthToken(r *http.Request, refreshToken string, clientID string,
 	return token, nil
 }
 
-// LoadAccessToken : load acces token from cookies
-func LoadAccessToken(w http.ResponseWriter, r *http.Request, accessTokenCookie CookieID, refreshTokenCookie CookieID, tokenExpiryCookie CookieID, clientID string, clientSecret string) (string, error) {
-	tokenExpiry, err := ReadCookie(r, tokenExpiryCookie)
+// LoadSession : load the request's session, refreshing its access token when expired.
+// A missing or tampered session cookie is reported as ErrSessionNotFound.
+func LoadSession(r *http.Request, sessions SessionStore, sessionCookie CookieID, clientID string, clientSecret string) (*Session, error) {
+	id, err := ReadCookie(r, sessionCookie)
 	if err != nil {
-		return "", err
+		return nil, ErrSessionNotFound
 	}
-	expiryTime, err := time.Parse(TimeLayout, tokenExpiry)
+	session, err := sessions.Get(r.Context(), id)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if time.Since(expiryTime) > 0 {
-		refreshToken, err := ReadCookie(r, refreshTokenCookie)
+	SetLogUser(r.Context(), session.User.ID)
+	if time.Since(session.Expiry) > 0 {
+		token, err := RequestNewOAuthToken(r, session.Token.RefreshToken, clientID, clientSecret)
 		if err != nil {
-			return "", err
+			tokenRefreshes.WithLabelValues("error").Inc()
+			return nil, err
 		}
-		token, err := RequestNewOAuthToken(r, refreshToken, clientID, clientSecret)
-		if err != nil {
-			return "", err
+		tokenRefreshes.WithLabelValues("ok").Inc()
+		if token.RefreshToken == "" {
+			token.RefreshToken = session.Token.RefreshToken
 		}
-		newTokenExpiry := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
-		if err := WriteCookie(w, accessTokenCookie, token.AccessToken, newTokenExpiry); err != nil {
-			return "", err
+		if token.Scope != "" {
+			session.Scopes = strings.Fields(token.Scope)
 		}
-		tokenExpiryValue := newTokenExpiry.Format(TimeLayout)
-		yearExpiry := time.Now().Add(365 * 24 * time.Hour)
-		if err := WriteCookie(w, tokenExpiryCookie, tokenExpiryValue, yearExpiry); err != nil {
-			return "", err
+		session.Token = *token
+		session.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+		if err := sessions.Save(r.Context(), id, session, SessionLifetime); err != nil {
+			return nil, err
 		}
-		return token.AccessToken, nil
 	}
-	accessToken, err := ReadCookie(r, accessTokenCookie)
-	if err != nil {
-		return "", err
-	}
-	return accessToken, nil
+	return session, nil
+}
+
+// QueryInt : read integer query parameter name, def when absent, an error when
+// it is not a whole number in [min, max]
+func QueryInt(params url.Values, name string, def int, min int, max int) (int, error) {
+	v := params.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%s must be a whole number from %d to %d", name, min, max)
+	}
+	return n, nil
 }
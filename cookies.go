@@ -9,23 +9,21 @@ import (
 
 // CookieID : cookie identification
 type CookieID struct {
-	secure *securecookie.SecureCookie
+	codecs []securecookie.Codec
 	name   string
 }
 
-// GenerateCookie : generate a secure cookie
-func GenerateCookie(name string) CookieID {
+// NewCookie : create a secure cookie signed with codecs
+func NewCookie(name string, codecs []securecookie.Codec) CookieID {
 	var c CookieID
-	hash := GenerateRandomBytes(16)
-	block := GenerateRandomBytes(16)
-	c.secure = securecookie.New(hash, block)
+	c.codecs = codecs
 	c.name = name
 	return c
 }
 
 // WriteCookie : create an http cookie
 func WriteCookie(w http.ResponseWriter, c CookieID, value string, expiry time.Time) error {
-	encoded, err := c.secure.Encode(c.name, value)
+	encoded, err := securecookie.EncodeMulti(c.name, value, c.codecs...)
 	if err != nil {
 		return err
 	}
@@ -48,7 +46,7 @@ func ReadCookie(r *http.Request, c CookieID) (string, error) {
 		return "", err
 	}
 	var dst string
-	decodeErr := c.secure.Decode(c.name, httpCookie.Value, &dst)
+	decodeErr := securecookie.DecodeMulti(c.name, httpCookie.Value, &dst, c.codecs...)
 	if decodeErr != nil {
 		return "", decodeErr
 	}
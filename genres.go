@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getmicah/myapp-api/spotify"
+)
+
+// maxGenreSuggestions : most close matches suggested for an unknown genre
+const maxGenreSuggestions = 5
+
+// genreRefreshInterval : a forced refresh of a list younger than this is served
+// from the cache, so ?refresh cannot be used to hammer Spotify
+const genreRefreshInterval = time.Minute
+
+// GenreCache : Spotify's available genre seeds, fetched at most once per ttl
+type GenreCache struct {
+	api    *spotify.Client
+	ttl    time.Duration
+	mu     sync.Mutex
+	at     time.Time
+	genres []string
+	// fetching : closed when the fetch in flight is done, nil when there is none
+	fetching chan struct{}
+	// err : error of the last fetch
+	err error
+}
+
+// NewGenreCache : cache genre seeds fetched with api for ttl
+func NewGenreCache(api *spotify.Client, ttl time.Duration) *GenreCache {
+	return &GenreCache{api: api, ttl: ttl}
+}
+
+// Genres : cached genre seeds, fetched again with accessToken once older than
+// ttl or when refresh is set and they are older than genreRefreshInterval.
+// Concurrent callers share one fetch. A failed fetch keeps serving the previous
+// list.
+func (c *GenreCache) Genres(ctx context.Context, accessToken string, refresh bool) ([]string, time.Time, error) {
+	c.mu.Lock()
+	if refresh && time.Since(c.at) < genreRefreshInterval {
+		refresh = false
+	}
+	if !refresh && !c.at.IsZero() && time.Since(c.at) < c.ttl {
+		defer c.mu.Unlock()
+		return c.genres, c.at, nil
+	}
+	done := c.fetching
+	if done == nil {
+		done = make(chan struct{})
+		c.fetching = done
+		// not cancelled with this request, others may be waiting for it
+		go c.fetch(context.WithoutCancel(ctx), accessToken, done)
+	}
+	c.mu.Unlock()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, time.Time{}, ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.genres == nil {
+		return nil, time.Time{}, c.err
+	}
+	return c.genres, c.at, nil
+}
+
+// fetch : fetch the genre seeds without holding mu, then store them and close done
+func (c *GenreCache) fetch(ctx context.Context, accessToken string, done chan struct{}) {
+	genres, err := c.api.AvailableGenreSeeds(ctx, accessToken)
+	if err == nil {
+		sort.Strings(genres)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	if err == nil {
+		c.genres = genres
+		c.at = time.Now()
+	}
+	c.fetching = nil
+	close(done)
+}
+
+// CheckGenres : error listing close matches for the first of seeds that is not in genres
+func CheckGenres(seeds []string, genres []string) error {
+	for _, s := range seeds {
+		i := sort.SearchStrings(genres, s)
+		if i < len(genres) && genres[i] == s {
+			continue
+		}
+		matches := CloseGenres(s, genres)
+		if len(matches) == 0 {
+			return BadRequest(CodeInvalidSeed, "Unknown genre %q, see /genres", s)
+		}
+		p := NewProblem(http.StatusBadRequest, CodeInvalidSeed, fmt.Sprintf("Unknown genre %q, did you mean %s?", s, strings.Join(matches, ", ")))
+		p.Suggestions = matches
+		return &ProblemError{Problem: p}
+	}
+	return nil
+}
+
+// CloseGenres : genres within a small edit distance of s or containing it, closest first
+func CloseGenres(s string, genres []string) []string {
+	type match struct {
+		genre string
+		dist  int
+	}
+	limit := len(s)/4 + 1
+	var matches []match
+	for _, g := range genres {
+		d := editDistance(s, g)
+		if d <= limit || strings.Contains(g, s) || (len(g) > 2 && strings.Contains(s, g)) {
+			matches = append(matches, match{g, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].dist < matches[j].dist
+	})
+	var out []string
+	for i := 0; i < len(matches) && i < maxGenreSuggestions; i++ {
+		out = append(out, matches[i].genre)
+	}
+	return out
+}
+
+// editDistance : Levenshtein distance between a and b
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getmicah/myapp-api/spotify"
+)
+
+func TestGenreCacheSharesOneFetch(t *testing.T) {
+	var mu sync.Mutex
+	fetches := 0
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		<-release
+		io.WriteString(w, `{"genres":["rock","pop"]}`)
+	}))
+	defer srv.Close()
+	c := NewGenreCache(spotify.New(srv.URL+"/v1", nil), time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			genres, _, err := c.Genres(context.Background(), "tok", false)
+			if err != nil || !slices.Equal(genres, []string{"pop", "rock"}) {
+				t.Errorf("got %q, %v", genres, err)
+			}
+		}()
+	}
+	// a caller giving up does not wait for the fetch in flight
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := c.Genres(ctx, "tok", false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v while the fetch was in flight, want the deadline", err)
+	}
+	close(release)
+	wg.Wait()
+
+	// refreshing a list fetched moments ago is served from the cache
+	if _, _, err := c.Genres(context.Background(), "tok", true); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fetches != 1 {
+		t.Errorf("fetched %d times, want 1", fetches)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// set with -ldflags "-X main.version=... -X main.commit=... -X main.buildTime=..."
+// when building outside a vcs checkout, otherwise read from the build info
+var (
+	version   = ""
+	commit    = ""
+	buildTime = ""
+)
+
+// HealthHandler : /healthz, the process is up and serving
+type HealthHandler struct{}
+
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	SendJSON(w, http.StatusOK, HealthStatus{Status: "ok"})
+}
+
+// ReadyHandler : /readyz, cookie keys are loaded (and cookieKeyFile, when keys
+// come from one, still holds keys for the next restart) and optionally Spotify
+// is reachable
+type ReadyHandler struct {
+	cookieKeys    int
+	cookieKeyFile string
+	probe         *SpotifyProbe
+}
+
+func (h *ReadyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{"cookie_keys": h.checkCookieKeys()}
+	status := http.StatusOK
+	if checks["cookie_keys"] != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	if h.probe != nil {
+		if err := h.probe.Check(r.Context()); err != nil {
+			checks["spotify"] = err.Error()
+			status = http.StatusServiceUnavailable
+		} else {
+			checks["spotify"] = "ok"
+		}
+	}
+	res := HealthStatus{Status: "ok", Checks: checks}
+	if status != http.StatusOK {
+		res.Status = "unavailable"
+	}
+	SendJSON(w, status, res)
+}
+
+// checkCookieKeys : "ok" or what is wrong with the cookie keys
+func (h *ReadyHandler) checkCookieKeys() string {
+	if h.cookieKeys == 0 {
+		return "missing"
+	}
+	if h.cookieKeyFile == "" {
+		return "ok"
+	}
+	f, err := readCookieKeyFile(h.cookieKeyFile)
+	if err != nil {
+		return err.Error()
+	}
+	if len(f.Keys) == 0 {
+		return h.cookieKeyFile + ": no cookie keys"
+	}
+	return "ok"
+}
+
+// SpotifyProbe : cached reachability check of the Spotify accounts service
+type SpotifyProbe struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	mu     sync.Mutex
+	at     time.Time
+	err    error
+}
+
+// NewSpotifyProbe : probe url at most once per ttl
+func NewSpotifyProbe(url string, ttl time.Duration, timeout time.Duration) *SpotifyProbe {
+	return &SpotifyProbe{
+		url: url,
+		ttl: ttl,
+		client: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Check : last probe result, probing again once it is older than ttl
+func (p *SpotifyProbe) Check(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.at.IsZero() && time.Since(p.at) < p.ttl {
+		return p.err
+	}
+	p.err = p.probe(ctx)
+	p.at = time.Now()
+	return p.err
+}
+
+func (p *SpotifyProbe) probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 500 {
+		return errors.New(res.Status)
+	}
+	return nil
+}
+
+// VersionHandler : /version, build information
+type VersionHandler struct {
+	info BuildInfo
+}
+
+// NewVersionHandler : read build information once at startup
+func NewVersionHandler() *VersionHandler {
+	info := BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	return &VersionHandler{info: info}
+}
+
+func (h *VersionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	SendJSON(w, http.StatusOK, h.info)
+}
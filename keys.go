@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/gorilla/securecookie"
+)
+
+const (
+	// CookieHashKeyLength : length of generated HMAC keys
+	CookieHashKeyLength = 64
+	// CookieBlockKeyLength : length of generated AES-256 keys
+	CookieBlockKeyLength = 32
+	// CookieKeysKept : keys kept by `keys rotate` unless -keep is given
+	CookieKeysKept = 2
+)
+
+// CookieKey : hash/block key pair used to sign and encrypt cookies
+type CookieKey struct {
+	Hash  string `json:"hash"`
+	Block string `json:"block"`
+}
+
+// CookieKeyFile : on-disk cookie keys, newest first
+type CookieKeyFile struct {
+	Keys []CookieKey `json:"keys"`
+}
+
+// GenerateCookieKey : create a random key pair
+func GenerateCookieKey() CookieKey {
+	return CookieKey{
+		Hash:  base64.StdEncoding.EncodeToString(GenerateRandomBytes(CookieHashKeyLength)),
+		Block: base64.StdEncoding.EncodeToString(GenerateRandomBytes(CookieBlockKeyLength)),
+	}
+}
+
+// CookieCodecs : build securecookie codecs from keys, the first key encodes
+// and every key decodes so cookies signed before a rotation stay valid
+func CookieCodecs(keys []CookieKey) ([]securecookie.Codec, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no cookie keys")
+	}
+	pairs := make([][]byte, 0, len(keys)*2)
+	for i, k := range keys {
+		hash, err := base64.StdEncoding.DecodeString(k.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("cookie key %d: hash: %v", i, err)
+		}
+		block, err := base64.StdEncoding.DecodeString(k.Block)
+		if err != nil {
+			return nil, fmt.Errorf("cookie key %d: block: %v", i, err)
+		}
+		if len(hash) < 32 {
+			return nil, fmt.Errorf("cookie key %d: hash must be at least 32 bytes", i)
+		}
+		switch len(block) {
+		case 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("cookie key %d: block must be 16, 24 or 32 bytes", i)
+		}
+		pairs = append(pairs, hash, block)
+	}
+	return securecookie.CodecsFromPairs(pairs...), nil
+}
+
+// LoadCookieKeys : load cookie keys from config, falling back to the key file.
+// Outside production a missing configuration generates throwaway keys.
+func LoadCookieKeys(c config) ([]CookieKey, error) {
+	if len(c.CookieKeys) > 0 {
+		return c.CookieKeys, nil
+	}
+	if c.CookieKeyFile != "" {
+		f, err := readCookieKeyFile(c.CookieKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(f.Keys) == 0 {
+			return nil, fmt.Errorf("%s: no cookie keys", c.CookieKeyFile)
+		}
+		return f.Keys, nil
+	}
+	if c.Production {
+		return nil, errors.New("cookieKeys or cookieKeyFile is required in production")
+	}
+	slog.Warn("no cookie keys configured, sessions will not survive a restart")
+	return []CookieKey{GenerateCookieKey()}, nil
+}
+
+func readCookieKeyFile(path string) (CookieKeyFile, error) {
+	var f CookieKeyFile
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(file, &f); err != nil {
+		return f, fmt.Errorf("%s: %v", path, err)
+	}
+	return f, nil
+}
+
+func writeCookieKeyFile(path string, f CookieKeyFile) error {
+	body, err := json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".cookie-keys-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(body, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// RunKeysCommand : `keys generate` and `keys rotate` admin commands
+func RunKeysCommand(args []string) error {
+	usage := errors.New("usage: keys generate [-file path] | keys rotate -file path [-keep n]")
+	if len(args) == 0 {
+		return usage
+	}
+	fs := flag.NewFlagSet("keys "+args[0], flag.ContinueOnError)
+	path := fs.String("file", "", "cookie key file")
+	keep := fs.Int("keep", CookieKeysKept, "number of keys to keep after rotating")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	switch args[0] {
+	case "generate":
+		f := CookieKeyFile{Keys: []CookieKey{GenerateCookieKey()}}
+		if *path == "" {
+			body, err := json.MarshalIndent(f, "", "\t")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(body))
+			return nil
+		}
+		if _, err := os.Stat(*path); err == nil {
+			return fmt.Errorf("%s already exists, use keys rotate", *path)
+		}
+		return writeCookieKeyFile(*path, f)
+	case "rotate":
+		if *path == "" {
+			return usage
+		}
+		if *keep < 1 {
+			return errors.New("-keep must be at least 1")
+		}
+		f, err := readCookieKeyFile(*path)
+		if err != nil {
+			return err
+		}
+		f.Keys = append([]CookieKey{GenerateCookieKey()}, f.Keys...)
+		if len(f.Keys) > *keep {
+			f.Keys = f.Keys[:*keep]
+		}
+		if err := writeCookieKeyFile(*path, f); err != nil {
+			return err
+		}
+		fmt.Printf("rotated %s, %d keys active\n", *path, len(f.Keys))
+		return nil
+	}
+	return usage
+}
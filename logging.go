@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewLogger : slog logger writing text or json at level
+func NewLogger(out io.Writer, format string, level string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("logLevel: %v", err)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(out, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(out, opts)), nil
+	}
+	return nil, fmt.Errorf("logFormat must be text or json, got %q", format)
+}
+
+// upstreamCall : timing of one Spotify request made while serving a request
+type upstreamCall struct {
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Status     int     `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// requestLog : request-scoped fields filled in by handlers and the Spotify transport
+type requestLog struct {
+	mu       sync.Mutex
+	id       string
+	userID   string
+	err      string
+	upstream []upstreamCall
+}
+
+type requestLogKey struct{}
+
+func getRequestLog(ctx context.Context) *requestLog {
+	l, _ := ctx.Value(requestLogKey{}).(*requestLog)
+	return l
+}
+
+// RequestID : id of the request being served, empty outside the logging middleware
+func RequestID(ctx context.Context) string {
+	if l := getRequestLog(ctx); l != nil {
+		return l.id
+	}
+	return ""
+}
+
+// SetLogUser : record the Spotify user a request is made for
+func SetLogUser(ctx context.Context, userID string) {
+	if l := getRequestLog(ctx); l != nil {
+		l.mu.Lock()
+		l.userID = userID
+		l.mu.Unlock()
+	}
+}
+
+// loggingWriter : http.ResponseWriter recording status, size and error message
+type loggingWriter struct {
+	http.ResponseWriter
+	log    *requestLog
+	status int
+	bytes  int
+}
+
+func (w *loggingWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *loggingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *loggingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// setError : called by SendProblem so failed requests log why they failed
+func (w *loggingWriter) setError(message string) {
+	w.log.mu.Lock()
+	w.log.err = message
+	w.log.mu.Unlock()
+}
+
+// LoggingMiddleware : log one line per request with its outcome and Spotify calls
+func LoggingMiddleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 64 {
+			id = GenerateRandomString(12)
+		}
+		l := &requestLog{id: id}
+		lw := &loggingWriter{ResponseWriter: w, log: l}
+		lw.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(lw, r.WithContext(context.WithValue(r.Context(), requestLogKey{}, l)))
+
+		status := lw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		} else if status >= 400 {
+			level = slog.LevelWarn
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int("bytes", lw.bytes),
+			slog.String("request_id", id),
+		}
+		if l.userID != "" {
+			attrs = append(attrs, slog.String("user_id", l.userID))
+		}
+		if l.err != "" {
+			attrs = append(attrs, slog.String("error", l.err))
+		}
+		if len(l.upstream) > 0 {
+			attrs = append(attrs, slog.Any("spotify", l.upstream))
+		}
+		logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// LogTransport : http.RoundTripper recording Spotify call timings on the request log
+type LogTransport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip : implement http.RoundTripper
+func (t *LogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.Base.RoundTrip(req)
+	if l := getRequestLog(req.Context()); l != nil {
+		call := upstreamCall{
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if res != nil {
+			call.Status = res.StatusCode
+		}
+		l.mu.Lock()
+		l.upstream = append(l.upstream, call)
+		l.mu.Unlock()
+	}
+	return res, err
+}
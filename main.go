@@ -1,131 +1,204 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/getmicah/myapp-api/spotify"
 	"github.com/rs/cors"
 )
 
 const (
 	// ClientTimeout : timeout for http.Client
 	ClientTimeout = time.Second * 10
-	// TimeLayout : format for converting time to and from string
-	TimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+	// SpotifyAccountsURL : Spotify accounts service, probed by /readyz
+	SpotifyAccountsURL = "https://accounts.spotify.com"
 )
 
 func main() {
+	// admin commands
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		if err := RunKeysCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// config
-	config := getConfig("./config.json")
-	clientID := os.Getenv("SPOTIFY_CLIENT_ID")
-	clientSecret := os.Getenv("SPOTIFY_CLIENT_SECRET")
-	scope := []string{
-		"playlist-modify-public",
+	config, err := LoadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logger, err := NewLogger(os.Stderr, config.LogFormat, config.LogLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+	shutdownTracing, err := InitTracing(context.Background(), config)
+	if err != nil {
+		slog.Error("initializing tracing", "error", err)
+		os.Exit(2)
 	}
+	clientID := config.ClientID
+	clientSecret := config.ClientSecret
 
 	// cookies
-	authStateCookie := GenerateCookie("auth_state")
-	accessTokenCookie := GenerateCookie("access_token")
-	refreshTokenCookie := GenerateCookie("refresh_token")
-	tokenExpiryCookie := GenerateCookie("token_expiry")
+	cookieKeys, err := LoadCookieKeys(config)
+	if err != nil {
+		slog.Error("loading cookie keys", "error", err)
+		os.Exit(2)
+	}
+	codecs, err := CookieCodecs(cookieKeys)
+	if err != nil {
+		slog.Error("loading cookie keys", "error", err)
+		os.Exit(2)
+	}
+	authStateCookie := NewCookie("auth_state", codecs)
+	authVerifierCookie := NewCookie("auth_verifier", codecs)
+	sessionCookie := NewCookie("session", codecs)
+
+	// sessions
+	sessions, err := NewSessionStore(config)
+	if err != nil {
+		slog.Error("opening session store", "error", err)
+		os.Exit(2)
+	}
+
+	// spotify
+	httpClient.Timeout = config.ClientTimeout.Duration
+	api := spotify.New(config.SpotifyURL, httpClient)
 
 	// router
-	mux := http.NewServeMux()
-	mux.Handle("/auth/login", &LoginHandler{
-		clientID:        clientID,
-		redirectURI:     config.RedirectURI,
-		scope:           scope,
-		authStateCookie: authStateCookie,
-	})
-	mux.Handle("/auth/logout", &LogoutHandler{
+	auth := &Auth{
+		sessionCookie: sessionCookie,
+		sessions:      sessions,
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		api:           api,
+	}
+	login := &LoginHandler{
+		clientID:           clientID,
+		redirectURI:        config.RedirectURI,
+		features:           DefaultFeatures,
+		pkce:               config.PKCE,
+		authStateCookie:    authStateCookie,
+		authVerifierCookie: authVerifierCookie,
+		sessionCookie:      sessionCookie,
+		sessions:           sessions,
+	}
+	logout := &LogoutHandler{
 		cookies: []CookieID{
 			authStateCookie,
-			accessTokenCookie,
-			refreshTokenCookie,
-			tokenExpiryCookie,
+			authVerifierCookie,
+			sessionCookie,
 		},
-		appURL: config.AppURL,
-	})
-	mux.Handle("/auth/callback", &CallbackHandler{
+		sessionCookie: sessionCookie,
+		sessions:      sessions,
+		appURL:        config.AppURL,
+	}
+	callback := &CallbackHandler{
+		api:                api,
 		authStateCookie:    authStateCookie,
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
+		authVerifierCookie: authVerifierCookie,
+		sessionCookie:      sessionCookie,
+		sessions:           sessions,
 		clientID:           clientID,
 		clientSecret:       clientSecret,
 		redirectURI:        config.RedirectURI,
 		appURL:             config.AppURL,
-	})
-	mux.Handle("/auth", &AuthHandler{
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
-		clientID:           clientID,
-		clientSecret:       clientSecret,
-	})
-	mux.Handle("/search", &SearchHandler{
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
-		clientID:           clientID,
-		clientSecret:       clientSecret,
-	})
-	mux.Handle("/artist", &ArtistHandler{
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
-		clientID:           clientID,
-		clientSecret:       clientSecret,
-	})
-	mux.Handle("/track", &TrackHandler{
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
-		clientID:           clientID,
-		clientSecret:       clientSecret,
-	})
-	mux.Handle("/rec", &RecHandler{
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
-		clientID:           clientID,
-		clientSecret:       clientSecret,
-	})
-	mux.Handle("/playlist", &PlaylistHandler{
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
-		clientID:           clientID,
-		clientSecret:       clientSecret,
-	})
+		pkce:               config.PKCE,
+	}
+	search := &SearchHandler{
+		apiURL: config.APIURL,
+		market: config.Market,
+		limit:  config.SearchLimit,
+		api:    api,
+	}
+	artist := &ArtistHandler{
+		market: config.Market,
+		api:    api,
+	}
+	track := &TrackHandler{
+		market: config.Market,
+		api:    api,
+	}
+	genres := NewGenreCache(api, config.GenresTTL.Duration)
+	rec := &RecHandler{
+		market: config.Market,
+		limit:  config.RecLimit,
+		genres: genres,
+		api:    api,
+	}
+	playlist := &PlaylistHandler{
+		apiURL: config.APIURL,
+		api:    api,
+	}
+
+	rt := NewRouter()
+	rt.HandleFunc("GET", "/auth/login", login.get)
+	rt.HandleFunc("GET", "/auth/logout", logout.get)
+	rt.HandleFunc("GET", "/auth/callback", callback.get)
+	rt.Handle("GET", "/auth", auth.RequireFunc((&AuthHandler{}).get))
+	rt.Handle("GET", "/search", auth.RequireFunc(search.get))
+	rt.Handle("GET", "/artist", auth.RequireFunc(artist.get))
+	rt.Handle("GET", "/artist/top-tracks", auth.RequireFunc(artist.topTracks))
+	rt.Handle("GET", "/track", auth.RequireFunc(track.get))
+	rt.Handle("GET", "/rec", auth.RequireFunc(rec.get))
+	rt.Handle("GET", "/genres", auth.RequireFunc((&GenresHandler{genres: genres}).get))
+	rt.Handle("POST", "/playlist", auth.RequireFunc(playlist.post))
+	rt.Handle("PUT", "/playlist/{id}/tracks", auth.RequireFunc(playlist.replaceTracks))
+	rt.Handle("POST", "/playlist/{id}/tracks", auth.RequireFunc(playlist.appendTracks))
+	rt.Handle("DELETE", "/playlist/{id}/tracks", auth.RequireFunc(playlist.removeTracks))
+	rt.Handle("PATCH", "/playlist/{id}/tracks", auth.RequireFunc(playlist.reorderTracks))
 
 	// middleware
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{config.AppURL},
 		AllowCredentials: true,
-		AllowedMethods:   []string{"GET", "POST", "DELETE"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders:   []string{"Content-Type", "X-Request-ID", "traceparent", "tracestate"},
 	})
-	app := c.Handler(mux)
+	app := LoggingMiddleware(logger, TracingMiddleware(rt, MetricsMiddleware(rt, c.Handler(rt))))
+
+	// health checks skip CORS, logging, metrics and tracing
+	ready := &ReadyHandler{cookieKeys: len(codecs)}
+	if len(config.CookieKeys) == 0 {
+		ready.cookieKeyFile = config.CookieKeyFile
+	}
+	if config.ReadyProbe {
+		ready.probe = NewSpotifyProbe(SpotifyAccountsURL, config.ReadyProbeTTL.Duration, config.ClientTimeout.Duration)
+	}
+	root := http.NewServeMux()
+	root.Handle("/healthz", &HealthHandler{})
+	root.Handle("/readyz", ready)
+	root.Handle("/version", NewVersionHandler())
+	root.Handle("/", app)
 
 	// Go!
-	if config.Production {
-		err := http.ListenAndServeTLS(
-			":443",
-			"/etc/letsencrypt/live/api.micahcowell.com/fullchain.pem",
-			"/etc/letsencrypt/live/api.micahcowell.com/privkey.pem",
-			app,
-		)
-		if err != nil {
-			fmt.Println(err)
-		}
-	} else {
-		http.ListenAndServe(":3000", app)
+	serveErr := Serve(config, root)
+	if serveErr != nil {
+		slog.Error("serving", "error", serveErr)
+	}
+	if closer, ok := sessions.(io.Closer); ok {
+		closer.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout.Duration)
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("flushing traces", "error", err)
+	}
+	cancel()
+	if serveErr != nil {
+		os.Exit(1)
 	}
 }
 
@@ -144,20 +217,3 @@ func GenerateRandomBytes(n int) []byte {
 	}
 	return b
 }
-
-type config struct {
-	APIURL      string `json:"apiURL"`
-	AppURL      string `json:"appURL"`
-	RedirectURI string `json:"redirectURI"`
-	Production  bool   `json:"production"`
-}
-
-func getConfig(path string) config {
-	file, err := ioutil.ReadFile(path)
-	if err != nil {
-		panic(err)
-	}
-	var c config
-	json.Unmarshal(file, &c)
-	return c
-}
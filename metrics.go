@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Requests served, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time spent serving requests, by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	spotifyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spotify_requests_total",
+		Help: "Requests made to Spotify, by endpoint, method and status code (0 for network errors).",
+	}, []string{"endpoint", "method", "status"})
+	spotifyDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "spotify_request_duration_seconds",
+		Help:    "Latency of requests made to Spotify, by endpoint and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint", "method"})
+	spotifyRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spotify_retries_total",
+		Help: "Spotify requests retried, by endpoint and reason (rate_limited, server_error, network_error).",
+	}, []string{"endpoint", "reason"})
+	tokenRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spotify_token_refreshes_total",
+		Help: "Access token refreshes performed while loading sessions, by result.",
+	}, []string{"result"})
+)
+
+// MetricsMiddleware : count and time requests, labelled by the mux pattern they matched
+func MetricsMiddleware(rt *Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := rt.Route(r)
+		if route == "" {
+			route = "other"
+		}
+		method := rt.Method(r)
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		status := sw.Status()
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusWriter : http.ResponseWriter recording the status code
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// Status : status code written, 200 if the handler never wrote one
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// setError : pass error messages through to the logging middleware
+func (w *statusWriter) setError(message string) {
+	if lw, ok := w.ResponseWriter.(interface{ setError(string) }); ok {
+		lw.setError(message)
+	}
+}
+
+// MetricsTransport : http.RoundTripper counting and timing each attempt made to Spotify
+type MetricsTransport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip : implement http.RoundTripper
+func (t *MetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.Base.RoundTrip(req)
+	endpoint := spotifyEndpoint(req.URL.Path)
+	status := "0"
+	if res != nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+	spotifyRequests.WithLabelValues(endpoint, req.Method, status).Inc()
+	spotifyDuration.WithLabelValues(endpoint, req.Method).Observe(time.Since(start).Seconds())
+	return res, err
+}
+
+// countRetry : spotify.Transport retry hook
+func countRetry(req *http.Request, res *http.Response, err error) {
+	reason := "network_error"
+	if err == nil && res.StatusCode == http.StatusTooManyRequests {
+		reason = "rate_limited"
+	} else if err == nil {
+		reason = "server_error"
+	}
+	spotifyRetries.WithLabelValues(spotifyEndpoint(req.URL.Path), reason).Inc()
+}
+
+// spotifyEndpoint : metric label for a Spotify url path with ids replaced,
+// e.g. /v1/playlists/abc/tracks becomes /v1/playlists/{id}/tracks
+func spotifyEndpoint(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		switch segments[i-1] {
+		case "artists", "tracks", "albums", "playlists", "users", "categories":
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
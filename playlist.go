@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/getmicah/myapp-api/spotify"
+)
+
+const (
+	// maxPlaylistName : longest playlist name accepted
+	maxPlaylistName = 100
+	// maxPlaylistDescription : longest playlist description accepted
+	maxPlaylistDescription = 300
+	// maxPlaylistImage : largest base64 encoded cover Spotify accepts
+	maxPlaylistImage = 256 << 10
+	// maxPlaylistBody : largest POST /playlist body read
+	maxPlaylistBody = 1 << 20
+)
+
+// DecodePlaylistBody : read and validate a POST /playlist body, filling in the
+// default name built from its seeds
+func DecodePlaylistBody(body io.Reader, now time.Time) (*PlaylistTracksBody, error) {
+	var pt PlaylistTracksBody
+	dec := json.NewDecoder(io.LimitReader(body, maxPlaylistBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&pt); err != nil {
+		return nil, BadRequest(CodeBadRequest, "Invalid playlist body: %v", err)
+	}
+	if len(pt.Seeds) > spotify.MaxSeeds {
+		return nil, BadRequest(CodeBadRequest, "At most %d seeds can name a playlist, got %d", spotify.MaxSeeds, len(pt.Seeds))
+	}
+	pt.Name = strings.TrimSpace(pt.Name)
+	if pt.Name == "" {
+		pt.Name = DefaultPlaylistName(pt.Seeds, now)
+	}
+	if utf8.RuneCountInString(pt.Name) > maxPlaylistName {
+		return nil, BadRequest(CodeBadRequest, "name must be at most %d characters", maxPlaylistName)
+	}
+	if utf8.RuneCountInString(pt.Description) > maxPlaylistDescription {
+		return nil, BadRequest(CodeBadRequest, "description must be at most %d characters", maxPlaylistDescription)
+	}
+	if strings.ContainsAny(pt.Description, "\r\n") {
+		return nil, BadRequest(CodeBadRequest, "description must be a single line")
+	}
+	if err := ValidateTrackURIs(pt.URIS, spotify.MaxPlaylistTracks); err != nil {
+		return nil, err
+	}
+	if pt.Collaborative && pt.IsPublic() {
+		return nil, BadRequest(CodeBadRequest, "collaborative playlists must be private")
+	}
+	if pt.Image != "" {
+		image, err := PlaylistImage(pt.Image)
+		if err != nil {
+			return nil, err
+		}
+		pt.Image = image
+	}
+	return &pt, nil
+}
+
+// PlaylistImage : validate a cover image given as base64 (optionally a data: url)
+// and return it as the bare base64 JPEG Spotify expects
+func PlaylistImage(image string) (string, error) {
+	image = strings.TrimPrefix(image, "data:image/jpeg;base64,")
+	if len(image) > maxPlaylistImage {
+		return "", BadRequest(CodeBadRequest, "image must be at most %d KB of base64", maxPlaylistImage>>10)
+	}
+	raw, err := base64.StdEncoding.DecodeString(image)
+	if err != nil {
+		return "", BadRequest(CodeBadRequest, "image must be base64 encoded")
+	}
+	if !bytes.HasPrefix(raw, []byte{0xFF, 0xD8, 0xFF}) {
+		return "", BadRequest(CodeBadRequest, "image must be a JPEG")
+	}
+	return image, nil
+}
+
+// DefaultPlaylistName : name for a playlist generated from seeds on day now, e.g.
+// "Recs based on Radiohead + Bjork — 2026-10-17"
+func DefaultPlaylistName(seeds []string, now time.Time) string {
+	date := now.Format("2006-01-02")
+	var names []string
+	for _, s := range seeds {
+		if s = strings.TrimSpace(s); s != "" {
+			names = append(names, s)
+		}
+	}
+	if len(names) == 0 {
+		return "Your recs — " + date
+	}
+	n := len(names)
+	name := seedPlaylistName(names, 0, date)
+	// drop seeds from the end until the name fits
+	for utf8.RuneCountInString(name) > maxPlaylistName && n > 1 {
+		n--
+		name = seedPlaylistName(names[:n], len(names)-n, date)
+	}
+	// then shorten the one seed left
+	if over := utf8.RuneCountInString(name) - maxPlaylistName; over > 0 {
+		first := []rune(names[0])
+		if over+1 >= len(first) {
+			return "Your recs — " + date
+		}
+		name = seedPlaylistName([]string{string(first[:len(first)-over-1]) + "…"}, len(names)-1, date)
+	}
+	return name
+}
+
+// seedPlaylistName : "Recs based on a + b + <more> more — date"
+func seedPlaylistName(names []string, more int, date string) string {
+	seeds := strings.Join(names, " + ")
+	if more > 0 {
+		seeds += fmt.Sprintf(" + %d more", more)
+	}
+	return fmt.Sprintf("Recs based on %s — %s", seeds, date)
+}
+
+// NewPlaylistFromBody : the playlist to create for pt
+func NewPlaylistFromBody(pt *PlaylistTracksBody) spotify.NewPlaylist {
+	return spotify.NewPlaylist{
+		Name:          pt.Name,
+		Description:   pt.Description,
+		Public:        pt.IsPublic(),
+		Collaborative: pt.Collaborative,
+	}
+}
+
+// trackURI : the only uri form playlists accept from us
+var trackURI = regexp.MustCompile(`^spotify:track:[0-9A-Za-z]{22}$`)
+
+// chunkRetries : retries of a failed chunk after the transport's own retries
+const chunkRetries = 2
+
+// chunkBackoff : wait before the first chunk retry, doubled on each retry
+var chunkBackoff = 500 * time.Millisecond
+
+// ValidateTrackURIs : 1 to max spotify:track uris
+func ValidateTrackURIs(uris []string, max int) error {
+	if len(uris) == 0 {
+		return BadRequest(CodeBadRequest, "uris must list at least one track")
+	}
+	if len(uris) > max {
+		return BadRequest(CodeBadRequest, "uris can list at most %d tracks, got %d", max, len(uris))
+	}
+	for i, u := range uris {
+		if !trackURI.MatchString(u) {
+			return BadRequest(CodeBadRequest, "uris[%d] %q is not a spotify:track uri", i, u)
+		}
+	}
+	return nil
+}
+
+// ChunkError : a chunk of tracks that could not be added, the Added tracks in
+// earlier chunks were
+type ChunkError struct {
+	Index int
+	Added int
+	Size  int
+	Err   error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("adding chunk %d (tracks %d to %d) failed after %d tracks were added: %v",
+		e.Index, e.Added, e.Added+e.Size-1, e.Added, e.Err)
+}
+
+// Unwrap : the Spotify error that failed the chunk
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// AddTracksInChunks : add uris to a playlist holding base tracks at snapshot, in
+// order and at most 100 per request, retrying failed chunks. They are appended when
+// position is negative and inserted before position otherwise. Returns the last
+// snapshot id and a *ChunkError for the first chunk that failed.
+func AddTracksInChunks(ctx context.Context, api *spotify.Client, accessToken string, playlistID string, uris []string, base int, position int, snapshot string) (string, error) {
+	for i := 0; i*spotify.MaxTracksPerRequest < len(uris); i++ {
+		start := i * spotify.MaxTracksPerRequest
+		end := start + spotify.MaxTracksPerRequest
+		if end > len(uris) {
+			end = len(uris)
+		}
+		at := -1
+		if position >= 0 {
+			at = position + start
+		}
+		s, err := addChunk(ctx, api, accessToken, playlistID, uris[start:end], base+start, at, snapshot)
+		if err != nil {
+			return snapshot, &ChunkError{Index: i, Added: start, Size: end - start, Err: err}
+		}
+		snapshot = s
+	}
+	return snapshot, nil
+}
+
+// addChunk : add one chunk to a playlist holding before tracks at snapshot, at
+// position unless it is negative. A failed attempt is only sent again once
+// chunkApplied says it did not go through, so tracks are never added twice.
+func addChunk(ctx context.Context, api *spotify.Client, accessToken string, playlistID string, chunk []string, before int, position int, snapshot string) (string, error) {
+	at := position
+	if at < 0 {
+		at = before
+	}
+	wait := chunkBackoff
+	for attempt := 0; ; attempt++ {
+		var s string
+		var err error
+		if position < 0 {
+			s, err = api.AddTracks(ctx, accessToken, playlistID, chunk)
+		} else {
+			s, err = api.InsertTracks(ctx, accessToken, playlistID, chunk, position)
+		}
+		if err == nil || attempt >= chunkRetries || !retryableChunk(err) {
+			return s, err
+		}
+		delay := wait
+		var spErr *spotify.Error
+		if errors.As(err, &spErr) && spErr.RateLimited() {
+			delay = max(delay, spErr.RetryAfter)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", err
+		case <-timer.C:
+		}
+		wait *= 2
+		applied, s, err := chunkApplied(ctx, api, accessToken, playlistID, chunk, at, snapshot)
+		if err != nil || applied {
+			return s, err
+		}
+	}
+}
+
+// chunkApplied : whether a chunk whose request failed was added at at anyway. An
+// unchanged snapshot means it was not and a changed one holding the chunk at at
+// means it was. When someone else changed the playlist meanwhile there is no
+// telling, which is a conflict rather than a reason to risk adding it twice.
+func chunkApplied(ctx context.Context, api *spotify.Client, accessToken string, playlistID string, chunk []string, at int, snapshot string) (bool, string, error) {
+	p, err := api.GetPlaylist(ctx, accessToken, playlistID, "snapshot_id")
+	if err != nil {
+		return false, "", err
+	}
+	if p.SnapshotID == snapshot {
+		return false, snapshot, nil
+	}
+	page, err := api.GetPlaylistItems(ctx, accessToken, playlistID, at, len(chunk))
+	if err != nil {
+		return false, "", err
+	}
+	applied := len(page.Items) == len(chunk)
+	for i := 0; applied && i < len(chunk); i++ {
+		applied = page.Items[i].Track.URI == chunk[i]
+	}
+	if !applied {
+		msg := fmt.Sprintf("Playlist %s changed while tracks were added to it, reload it to see which were", playlistID)
+		return false, "", &ProblemError{Problem: NewProblem(http.StatusConflict, CodePlaylistChanged, msg)}
+	}
+	return true, p.SnapshotID, nil
+}
+
+// retryableChunk : whether a failed chunk may succeed when sent again
+func retryableChunk(err error) bool {
+	var spErr *spotify.Error
+	if errors.As(err, &spErr) {
+		return spErr.RateLimited() || spErr.Status >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// ChunkProblem : SpotifyProblem for a failed AddTracksInChunks, naming the failed chunk
+func ChunkProblem(err error) Problem {
+	p := SpotifyProblem(err)
+	var pErr *ProblemError
+	if errors.As(err, &pErr) {
+		p = pErr.Problem
+	}
+	var chunkErr *ChunkError
+	if errors.As(err, &chunkErr) {
+		p.Detail = chunkErr.Error()
+		p.FailedChunk = &chunkErr.Index
+		p.TracksAdded = chunkErr.Added
+	}
+	return p
+}
+
+// playlist creation steps, as reported when one fails
+const (
+	StepCreatePlaylist = "create_playlist"
+	StepAddTracks      = "add_tracks"
+	StepUploadImage    = "upload_image"
+)
+
+// rollbackTimeout : time allowed to undo a failed playlist creation, even when
+// the request itself was cancelled
+const rollbackTimeout = 10 * time.Second
+
+// SagaError : a playlist creation step that failed and the rollback done for it
+type SagaError struct {
+	Step     string
+	Err      error
+	Rollback *RollbackReport
+}
+
+func (e *SagaError) Error() string {
+	msg := fmt.Sprintf("%s failed: %v", e.Step, e.Err)
+	if e.Rollback == nil {
+		return msg
+	}
+	if e.Rollback.Done {
+		return msg + "; the created playlist " + e.Rollback.PlaylistID + " was removed"
+	}
+	return msg + "; the created playlist " + e.Rollback.PlaylistID + " could not be removed: " + e.Rollback.Error
+}
+
+// Unwrap : the error that failed the step
+func (e *SagaError) Unwrap() error {
+	return e.Err
+}
+
+// CreatePlaylistSaga : create userID's playlist from pt, add its tracks and upload
+// its cover. A failure after the playlist exists removes it again, so users are
+// never left with an empty or half filled playlist; the *SagaError says which
+// step failed and whether the removal worked.
+func CreatePlaylistSaga(ctx context.Context, api *spotify.Client, accessToken string, userID string, pt *PlaylistTracksBody) (*spotify.Playlist, error) {
+	playlist, err := api.CreatePlaylist(ctx, accessToken, userID, NewPlaylistFromBody(pt))
+	if err != nil {
+		return nil, &SagaError{Step: StepCreatePlaylist, Err: err}
+	}
+	fail := func(step string, err error) error {
+		return &SagaError{Step: step, Err: err, Rollback: rollbackPlaylist(ctx, api, accessToken, playlist.ID)}
+	}
+	if _, err := AddTracksInChunks(ctx, api, accessToken, playlist.ID, pt.URIS, 0, -1, playlist.SnapshotID); err != nil {
+		return nil, fail(StepAddTracks, err)
+	}
+	if pt.Image != "" {
+		if err := api.UploadPlaylistImage(ctx, accessToken, playlist.ID, pt.Image); err != nil {
+			return nil, fail(StepUploadImage, err)
+		}
+	}
+	return playlist, nil
+}
+
+// rollbackPlaylist : unfollow (delete) the playlist created by a failed saga
+func rollbackPlaylist(ctx context.Context, api *spotify.Client, accessToken string, playlistID string) *RollbackReport {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+	report := &RollbackReport{PlaylistID: playlistID, Action: "unfollow_playlist", Done: true}
+	if err := api.UnfollowPlaylist(ctx, accessToken, playlistID); err != nil {
+		report.Done = false
+		report.Error = err.Error()
+	}
+	return report
+}
+
+// SagaProblem : problem for a failed CreatePlaylistSaga naming the failed step and the cleanup
+func SagaProblem(err error) Problem {
+	p := ChunkProblem(err)
+	var sagaErr *SagaError
+	if errors.As(err, &sagaErr) {
+		p.Detail = sagaErr.Error()
+		p.Step = sagaErr.Step
+		p.Rollback = sagaErr.Rollback
+	}
+	return p
+}
+
+// playlistEditFields : the parts of a playlist EditablePlaylist looks at
+const playlistEditFields = "id,snapshot_id,public,collaborative,owner.id,tracks.total"
+
+// EditablePlaylist : fetch a playlist whose tracks userID wants to change, an error
+// when it is neither theirs nor collaborative. Spotify has the final say on whether
+// a collaborative playlist includes them.
+func EditablePlaylist(ctx context.Context, api *spotify.Client, accessToken string, userID string, playlistID string) (*spotify.Playlist, error) {
+	p, err := api.GetPlaylist(ctx, accessToken, playlistID, playlistEditFields)
+	if err != nil {
+		return nil, err
+	}
+	if p.Owner.ID != userID && !p.Collaborative {
+		msg := fmt.Sprintf("Playlist %s belongs to %s and is not collaborative", playlistID, p.Owner.ID)
+		return nil, &ProblemError{Problem: NewProblem(http.StatusForbidden, CodeNotPlaylistOwner, msg)}
+	}
+	return p, nil
+}
+
+// DecodeEditBody : read a body changing an existing playlist's tracks into dst
+func DecodeEditBody(body io.Reader, dst interface{}) error {
+	dec := json.NewDecoder(io.LimitReader(body, maxPlaylistBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return BadRequest(CodeBadRequest, "Invalid body: %v", err)
+	}
+	return nil
+}
+
+// CheckSnapshot : conflict when snapshotID is set and p has changed since
+func CheckSnapshot(p *spotify.Playlist, snapshotID string) error {
+	if snapshotID == "" || snapshotID == p.SnapshotID {
+		return nil
+	}
+	msg := fmt.Sprintf("Playlist %s changed since snapshot %s, reload it and try again", p.ID, snapshotID)
+	pr := NewProblem(http.StatusConflict, CodePlaylistChanged, msg)
+	return &ProblemError{Problem: pr}
+}
+
+// ReplaceTracksInChunks : replace a playlist's tracks with uris in order, the first
+// 100 replacing what is there and the rest appended in chunks
+func ReplaceTracksInChunks(ctx context.Context, api *spotify.Client, accessToken string, playlistID string, uris []string) (string, error) {
+	first := uris
+	if len(first) > spotify.MaxTracksPerRequest {
+		first = first[:spotify.MaxTracksPerRequest]
+	}
+	snapshot, err := api.ReplaceTracks(ctx, accessToken, playlistID, first)
+	if err != nil {
+		return "", &ChunkError{Index: 0, Size: len(first), Err: err}
+	}
+	if len(uris) == len(first) {
+		return snapshot, nil
+	}
+	snapshot, err = AddTracksInChunks(ctx, api, accessToken, playlistID, uris[len(first):], len(first), -1, snapshot)
+	var chunkErr *ChunkError
+	if errors.As(err, &chunkErr) {
+		chunkErr.Index++
+		chunkErr.Added += len(first)
+	}
+	return snapshot, err
+}
+
+// ValidateRemoveBody : check a DELETE /playlist/{id}/tracks body against a playlist
+// of total tracks. Positions only mean something for a known snapshot.
+func ValidateRemoveBody(pr *PlaylistRemoveBody, total int) error {
+	switch {
+	case len(pr.URIS) > 0 && len(pr.Positions) > 0:
+		return BadRequest(CodeBadRequest, "Send either uris or positions, not both")
+	case len(pr.URIS) > 0:
+		return ValidateTrackURIs(pr.URIS, spotify.MaxTracksPerRequest)
+	case len(pr.Positions) == 0:
+		return BadRequest(CodeBadRequest, "uris or positions are required")
+	case len(pr.Positions) > spotify.MaxTracksPerRequest:
+		return BadRequest(CodeBadRequest, "At most %d positions can be removed at once, got %d", spotify.MaxTracksPerRequest, len(pr.Positions))
+	case pr.SnapshotID == "":
+		return BadRequest(CodeBadRequest, "snapshotId is required when removing positions")
+	}
+	seen := make(map[int]bool, len(pr.Positions))
+	for _, p := range pr.Positions {
+		if p < 0 || p >= total {
+			return BadRequest(CodeBadRequest, "Position %d is outside the playlist's %d tracks", p, total)
+		}
+		if seen[p] {
+			return BadRequest(CodeBadRequest, "Position %d is listed twice", p)
+		}
+		seen[p] = true
+	}
+	return nil
+}
+
+// TracksAtPositions : the tracks at positions of a playlist, grouped by uri the way
+// Spotify removes them. Each page of 100 holding a position is fetched once.
+func TracksAtPositions(ctx context.Context, api *spotify.Client, accessToken string, playlistID string, positions []int) ([]spotify.TrackRef, error) {
+	pages := make(map[int]*spotify.PlaylistItemPage)
+	byURI := make(map[string]int)
+	var refs []spotify.TrackRef
+	for _, p := range positions {
+		offset := p - p%spotify.MaxTracksPerRequest
+		page, ok := pages[offset]
+		if !ok {
+			var err error
+			page, err = api.GetPlaylistItems(ctx, accessToken, playlistID, offset, spotify.MaxTracksPerRequest)
+			if err != nil {
+				return nil, err
+			}
+			pages[offset] = page
+		}
+		i := p - offset
+		if i >= len(page.Items) || page.Items[i].Track.URI == "" {
+			return nil, BadRequest(CodeBadRequest, "Position %d has no track that can be removed", p)
+		}
+		uri := page.Items[i].Track.URI
+		if j, ok := byURI[uri]; ok {
+			refs[j].Positions = append(refs[j].Positions, p)
+			continue
+		}
+		byURI[uri] = len(refs)
+		refs = append(refs, spotify.TrackRef{URI: uri, Positions: []int{p}})
+	}
+	return refs, nil
+}
+
+// NewReorder : check a PATCH /playlist/{id}/tracks body against a playlist of total
+// tracks, rangeLength defaulting to 1
+func NewReorder(pr *PlaylistReorderBody, total int) (spotify.Reorder, error) {
+	ro := spotify.Reorder{RangeLength: 1, SnapshotID: pr.SnapshotID}
+	if pr.RangeStart == nil || pr.InsertBefore == nil {
+		return ro, BadRequest(CodeBadRequest, "rangeStart and insertBefore are required")
+	}
+	ro.RangeStart, ro.InsertBefore = *pr.RangeStart, *pr.InsertBefore
+	if pr.RangeLength != nil {
+		ro.RangeLength = *pr.RangeLength
+	}
+	if ro.RangeStart < 0 || ro.RangeStart >= total {
+		return ro, BadRequest(CodeBadRequest, "rangeStart must be from 0 to %d", total-1)
+	}
+	if ro.RangeLength < 1 || ro.RangeStart+ro.RangeLength > total {
+		return ro, BadRequest(CodeBadRequest, "rangeLength must be from 1 to %d", total-ro.RangeStart)
+	}
+	if ro.InsertBefore < 0 || ro.InsertBefore > total {
+		return ro, BadRequest(CodeBadRequest, "insertBefore must be from 0 to %d", total)
+	}
+	return ro, nil
+}
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/getmicah/myapp-api/spotify"
+)
+
+func TestDefaultPlaylistName(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	long := strings.Repeat("Ü", 120)
+	tests := []struct {
+		seeds []string
+		want  string
+	}{
+		{nil, "Your recs — 2026-10-17"},
+		{[]string{" ", ""}, "Your recs — 2026-10-17"},
+		{[]string{"Radiohead", "Bjork"}, "Recs based on Radiohead + Bjork — 2026-10-17"},
+		{[]string{strings.Repeat("a", 40), strings.Repeat("b", 40), "c"}, "Recs based on " + strings.Repeat("a", 40) + " + 2 more — 2026-10-17"},
+		{[]string{long}, "Recs based on " + strings.Repeat("Ü", 72) + "… — 2026-10-17"},
+		{[]string{long, "Bjork"}, "Recs based on " + strings.Repeat("Ü", 63) + "… + 1 more — 2026-10-17"},
+	}
+	for _, tt := range tests {
+		got := DefaultPlaylistName(tt.seeds, now)
+		if got != tt.want {
+			t.Errorf("DefaultPlaylistName(%q) = %q, want %q", tt.seeds, got, tt.want)
+		}
+		if n := utf8.RuneCountInString(got); n > maxPlaylistName {
+			t.Errorf("DefaultPlaylistName(%q) is %d characters", tt.seeds, n)
+		}
+	}
+}
+
+func TestDecodePlaylistBody(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	jpeg := base64.StdEncoding.EncodeToString([]byte{0xff, 0xd8, 0xff, 0xe0})
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n"))
+	tests := []struct {
+		fields string
+		ok     bool
+	}{
+		{`"name":" Mine "`, true},
+		{`"name":"` + strings.Repeat("n", maxPlaylistName+1) + `"`, false},
+		{`"description":"two\nlines"`, false},
+		{`"collaborative":true`, false},
+		{`"collaborative":true,"public":false`, true},
+		{`"image":"data:image/jpeg;base64,` + jpeg + `"`, true},
+		{`"image":"` + png + `"`, false},
+		{`"colour":"red"`, false},
+	}
+	for _, tt := range tests {
+		body := `{"uris":["spotify:track:4uLU6hMCjMI75M1A2tKUQC"],` + tt.fields + `}`
+		pt, err := DecodePlaylistBody(strings.NewReader(body), now)
+		if tt.ok {
+			if err != nil {
+				t.Errorf("%s: %v", tt.fields, err)
+			} else if pt.Name == "" || strings.HasPrefix(pt.Image, "data:") {
+				t.Errorf("%s: got name %q and image %q", tt.fields, pt.Name, pt.Image)
+			}
+			continue
+		}
+		var pErr *ProblemError
+		if !errors.As(err, &pErr) || pErr.Problem.Status != 400 {
+			t.Errorf("%s: got %v, want a 400 problem", tt.fields, err)
+		}
+	}
+}
+
+func TestDecodePlaylistBodyDefaultName(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	body := `{"uris":["spotify:track:4uLU6hMCjMI75M1A2tKUQC"],"seeds":["` + strings.Repeat("x", 150) + `"]}`
+	pt, err := DecodePlaylistBody(strings.NewReader(body), now)
+	if err != nil {
+		t.Fatalf("long seed: %v", err)
+	}
+	if n := utf8.RuneCountInString(pt.Name); n != maxPlaylistName {
+		t.Errorf("default name is %d characters, want %d", n, maxPlaylistName)
+	}
+	_, err = DecodePlaylistBody(strings.NewReader(`{"seeds":["a","b","c","d","e","f"]}`), now)
+	if err == nil {
+		t.Error("six seeds were accepted")
+	}
+}
+
+// fakePlaylist : Spotify Web API test server holding one playlist's tracks. fail
+// maps the n-th POST or PUT to its tracks (counted from 0) to how it fails:
+// "lost" applies it but answers 502, "down" answers 502, "reject" answers 400,
+// "limited" answers 429 asking to wait a second, "edited" answers 502 after a
+// collaborator added a track and "outage" answers 502 and so does the next GET.
+// reject names other calls answering 400: "create", "image" and "unfollow".
+// Playlist "theirs" belongs to someone else, "shared" too but is collaborative,
+// and "gone" does not exist.
+type fakePlaylist struct {
+	*httptest.Server
+	mu         sync.Mutex
+	tracks     []string
+	version    int
+	fail       map[int]string
+	writes     int
+	gets       int
+	outage     bool
+	reject     map[string]bool
+	image      bool
+	unfollowed bool
+	api        *spotify.Client
+}
+
+func newFakePlaylist(t *testing.T, tracks []string, fail map[int]string) *fakePlaylist {
+	f := &fakePlaylist{tracks: tracks, fail: fail}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/playlists/{id}", func(w http.ResponseWriter, r *http.Request) {
+		owner, collaborative := "tester", false
+		switch r.PathValue("id") {
+		case "theirs":
+			owner = "someone"
+		case "shared":
+			owner, collaborative = "someone", true
+		case "gone":
+			http.Error(w, `{"error":{"status":404,"message":"Not found."}}`, http.StatusNotFound)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.gets++
+		if f.outage {
+			f.outage = false
+			http.Error(w, `{"error":{"status":502,"message":"Bad gateway"}}`, http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintf(w, `{"id":%q,"snapshot_id":"snap-%d","collaborative":%t,"owner":{"id":%q},"tracks":{"total":%d}}`,
+			r.PathValue("id"), f.version, collaborative, owner, len(f.tracks))
+	})
+	mux.HandleFunc("GET /v1/playlists/{id}/tracks", func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.gets++
+		page := spotify.PlaylistItemPage{Paging: spotify.Paging{Offset: offset, Limit: limit, Total: len(f.tracks)}}
+		for _, uri := range f.tracks[min(offset, len(f.tracks)):min(offset+limit, len(f.tracks))] {
+			var item spotify.PlaylistItem
+			item.Track.URI = uri
+			page.Items = append(page.Items, item)
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+	write := func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			URIs     []string `json:"uris"`
+			Position *int     `json:"position"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		mode := f.fail[f.writes]
+		f.writes++
+		switch mode {
+		case "down":
+			http.Error(w, `{"error":{"status":502,"message":"Bad gateway"}}`, http.StatusBadGateway)
+			return
+		case "outage":
+			f.outage = true
+			http.Error(w, `{"error":{"status":502,"message":"Bad gateway"}}`, http.StatusBadGateway)
+			return
+		case "edited":
+			f.tracks = append(f.tracks, "spotify:track:theirs")
+			f.version++
+			http.Error(w, `{"error":{"status":502,"message":"Bad gateway"}}`, http.StatusBadGateway)
+			return
+		case "limited":
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, `{"error":{"status":429,"message":"API rate limit exceeded"}}`, http.StatusTooManyRequests)
+			return
+		case "reject":
+			http.Error(w, `{"error":{"status":400,"message":"Invalid track uri"}}`, http.StatusBadRequest)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPut:
+			f.tracks = append([]string(nil), body.URIs...)
+		case body.Position != nil:
+			f.tracks = append(f.tracks[:*body.Position], append(append([]string(nil), body.URIs...), f.tracks[*body.Position:]...)...)
+		default:
+			f.tracks = append(f.tracks, body.URIs...)
+		}
+		f.version++
+		if mode == "lost" {
+			http.Error(w, `{"error":{"status":502,"message":"Bad gateway"}}`, http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintf(w, `{"snapshot_id":"snap-%d"}`, f.version)
+	}
+	mux.HandleFunc("POST /v1/playlists/{id}/tracks", write)
+	mux.HandleFunc("PUT /v1/playlists/{id}/tracks", write)
+	// calls that fail with a 400 when named in reject, and otherwise just work
+	other := func(name string, answer string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if f.reject[name] {
+				http.Error(w, `{"error":{"status":400,"message":"Rejected"}}`, http.StatusBadRequest)
+				return
+			}
+			switch name {
+			case "image":
+				f.image = true
+			case "unfollow":
+				f.unfollowed = true
+			}
+			io.WriteString(w, answer)
+		}
+	}
+	mux.HandleFunc("POST /v1/users/{user}/playlists", other("create", `{"id":"pl","snapshot_id":"snap-0"}`))
+	mux.HandleFunc("PUT /v1/playlists/{id}/images", other("image", ""))
+	mux.HandleFunc("DELETE /v1/playlists/{id}/followers", other("unfollow", ""))
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	// a plain client, so only addChunk retries
+	f.api = spotify.New(f.URL+"/v1", &http.Client{Timeout: 5 * time.Second})
+	return f
+}
+
+func (f *fakePlaylist) state() (tracks []string, writes int, gets int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.tracks...), f.writes, f.gets
+}
+
+// testURIs : n distinct track uris starting at from
+func testURIs(from int, n int) []string {
+	uris := make([]string, n)
+	for i := range uris {
+		uris[i] = fmt.Sprintf("spotify:track:%022d", from+i)
+	}
+	return uris
+}
+
+func fastChunkBackoff(t *testing.T) {
+	old := chunkBackoff
+	chunkBackoff = time.Millisecond
+	t.Cleanup(func() { chunkBackoff = old })
+}
+
+func TestValidateTrackURIs(t *testing.T) {
+	tests := []struct {
+		uris []string
+		ok   bool
+	}{
+		{testURIs(0, 3), true},
+		{nil, false},
+		{testURIs(0, 4), false},
+		{[]string{"spotify:album:4uLU6hMCjMI75M1A2tKUQC"}, false},
+		{[]string{"spotify:track:short"}, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateTrackURIs(tt.uris, 3); (err == nil) != tt.ok {
+			t.Errorf("ValidateTrackURIs(%q) = %v", tt.uris, err)
+		}
+	}
+}
+
+func TestAddTracksInChunksDoesNotResendAppliedChunk(t *testing.T) {
+	fastChunkBackoff(t)
+	existing := testURIs(1000, 5)
+	f := newFakePlaylist(t, existing, map[int]string{1: "lost"})
+	uris := testURIs(0, 250)
+	snapshot, err := AddTracksInChunks(context.Background(), f.api, "tok", "pl", uris, len(existing), -1, "snap-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracks, writes, gets := f.state()
+	if want := append(append([]string(nil), existing...), uris...); !slices.Equal(tracks, want) {
+		t.Errorf("playlist holds %d tracks, want the %d existing and added ones once each", len(tracks), len(want))
+	}
+	if writes != 3 || gets != 2 || snapshot != "snap-3" {
+		t.Errorf("got %d writes, %d gets, snapshot %q, want 3, 2, snap-3", writes, gets, snapshot)
+	}
+}
+
+func TestAddTracksInChunksResendsUnappliedChunk(t *testing.T) {
+	fastChunkBackoff(t)
+	f := newFakePlaylist(t, nil, map[int]string{1: "down", 2: "down"})
+	uris := testURIs(0, 250)
+	if _, err := AddTracksInChunks(context.Background(), f.api, "tok", "pl", uris, 0, -1, "snap-0"); err != nil {
+		t.Fatal(err)
+	}
+	tracks, writes, gets := f.state()
+	if !slices.Equal(tracks, uris) {
+		t.Errorf("playlist holds %d tracks, want the 250 added in order", len(tracks))
+	}
+	if writes != 5 || gets != 2 {
+		t.Errorf("got %d writes and %d gets, want 5 and 2", writes, gets)
+	}
+}
+
+func TestAddTracksInChunksDoesNotResendWhenUnsure(t *testing.T) {
+	fastChunkBackoff(t)
+	tests := []struct {
+		name   string
+		mode   string
+		status int
+	}{
+		{"playlist check fails", "outage", http.StatusBadGateway},
+		{"playlist edited meanwhile", "edited", http.StatusConflict},
+	}
+	for _, tt := range tests {
+		f := newFakePlaylist(t, testURIs(1000, 5), map[int]string{1: tt.mode})
+		_, err := AddTracksInChunks(context.Background(), f.api, "tok", "pl", testURIs(0, 250), 5, -1, "snap-0")
+		var chunkErr *ChunkError
+		if !errors.As(err, &chunkErr) || chunkErr.Index != 1 {
+			t.Fatalf("%s: got %v, want a *ChunkError for chunk 1", tt.name, err)
+		}
+		if p := ChunkProblem(err); p.Status != tt.status {
+			t.Errorf("%s: got a %d problem, want %d", tt.name, p.Status, tt.status)
+		}
+		if _, writes, _ := f.state(); writes != 2 {
+			t.Errorf("%s: got %d writes, want 2 with the failed chunk not sent again", tt.name, writes)
+		}
+	}
+}
+
+func TestAddTracksInChunksWaitsRetryAfter(t *testing.T) {
+	fastChunkBackoff(t)
+	f := newFakePlaylist(t, nil, map[int]string{0: "limited"})
+	uris := testURIs(0, 10)
+	start := time.Now()
+	if _, err := AddTracksInChunks(context.Background(), f.api, "tok", "pl", uris, 0, -1, "snap-0"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("sent the chunk again after %v, want the second Spotify asked for", elapsed)
+	}
+	if tracks, writes, _ := f.state(); !slices.Equal(tracks, uris) || writes != 2 {
+		t.Errorf("got %d tracks after %d writes, want 10 after 2", len(tracks), writes)
+	}
+}
+
+func TestAddTracksInChunksInsertsAtPosition(t *testing.T) {
+	fastChunkBackoff(t)
+	existing := testURIs(1000, 3)
+	f := newFakePlaylist(t, existing, map[int]string{1: "lost"})
+	uris := testURIs(0, 150)
+	if _, err := AddTracksInChunks(context.Background(), f.api, "tok", "pl", uris, len(existing), 1, "snap-0"); err != nil {
+		t.Fatal(err)
+	}
+	tracks, writes, _ := f.state()
+	want := append(append(append([]string(nil), existing[:1]...), uris...), existing[1:]...)
+	if !slices.Equal(tracks, want) || writes != 2 {
+		t.Errorf("got %d tracks after %d writes, want the 150 inserted after the first track in 2 writes", len(tracks), writes)
+	}
+}
+
+func TestAddTracksInChunksReportsFailedChunk(t *testing.T) {
+	fastChunkBackoff(t)
+	tests := []struct {
+		name   string
+		fail   map[int]string
+		writes int
+	}{
+		{"rejected", map[int]string{2: "reject"}, 3},
+		{"retries exhausted", map[int]string{2: "down", 3: "down", 4: "down"}, 5},
+	}
+	for _, tt := range tests {
+		f := newFakePlaylist(t, nil, tt.fail)
+		uris := testURIs(0, 250)
+		_, err := AddTracksInChunks(context.Background(), f.api, "tok", "pl", uris, 0, -1, "snap-0")
+		var chunkErr *ChunkError
+		if !errors.As(err, &chunkErr) {
+			t.Fatalf("%s: got %v, want a *ChunkError", tt.name, err)
+		}
+		if chunkErr.Index != 2 || chunkErr.Added != 200 || chunkErr.Size != 50 {
+			t.Errorf("%s: got chunk %d with %d added and size %d, want 2, 200, 50", tt.name, chunkErr.Index, chunkErr.Added, chunkErr.Size)
+		}
+		tracks, writes, _ := f.state()
+		if !slices.Equal(tracks, uris[:200]) || writes != tt.writes {
+			t.Errorf("%s: playlist holds %d tracks after %d writes, want 200 after %d", tt.name, len(tracks), writes, tt.writes)
+		}
+	}
+}
+
+func TestEditablePlaylist(t *testing.T) {
+	f := newFakePlaylist(t, testURIs(0, 3), nil)
+	tests := []struct {
+		id     string
+		status int
+	}{
+		{"pl", 0},
+		{"shared", 0},
+		{"theirs", http.StatusForbidden},
+		{"gone", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		p, err := EditablePlaylist(context.Background(), f.api, "tok", "tester", tt.id)
+		status := 0
+		var pErr *ProblemError
+		var spErr *spotify.Error
+		switch {
+		case errors.As(err, &pErr):
+			status = pErr.Problem.Status
+		case errors.As(err, &spErr):
+			status = spErr.Status
+		case err != nil:
+			status = -1
+		}
+		if status != tt.status {
+			t.Errorf("%s: got %v, want status %d", tt.id, err, tt.status)
+		}
+		if err == nil && (p.ID != tt.id || p.Tracks.Total != 3) {
+			t.Errorf("%s: got playlist %q with %d tracks", tt.id, p.ID, p.Tracks.Total)
+		}
+	}
+}
+
+func TestReplaceTracksInChunks(t *testing.T) {
+	fastChunkBackoff(t)
+	f := newFakePlaylist(t, testURIs(1000, 5), nil)
+	uris := testURIs(0, 250)
+	snapshot, err := ReplaceTracksInChunks(context.Background(), f.api, "tok", "pl", uris)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracks, writes, _ := f.state()
+	if !slices.Equal(tracks, uris) || writes != 3 || snapshot != "snap-3" {
+		t.Errorf("got %d tracks after %d writes and snapshot %q, want the 250 after 3 and snap-3", len(tracks), writes, snapshot)
+	}
+}
+
+func TestReplaceTracksInChunksReportsFailedChunk(t *testing.T) {
+	fastChunkBackoff(t)
+	tests := []struct {
+		name  string
+		fail  map[int]string
+		index int
+		added int
+		size  int
+	}{
+		{"replace", map[int]string{0: "reject"}, 0, 0, 100},
+		{"append", map[int]string{2: "reject"}, 2, 200, 50},
+	}
+	for _, tt := range tests {
+		f := newFakePlaylist(t, testURIs(1000, 5), tt.fail)
+		_, err := ReplaceTracksInChunks(context.Background(), f.api, "tok", "pl", testURIs(0, 250))
+		var chunkErr *ChunkError
+		if !errors.As(err, &chunkErr) {
+			t.Fatalf("%s: got %v, want a *ChunkError", tt.name, err)
+		}
+		if chunkErr.Index != tt.index || chunkErr.Added != tt.added || chunkErr.Size != tt.size {
+			t.Errorf("%s: got chunk %d with %d added and size %d, want %d, %d, %d", tt.name, chunkErr.Index, chunkErr.Added, chunkErr.Size, tt.index, tt.added, tt.size)
+		}
+	}
+}
+
+func TestCreatePlaylistSaga(t *testing.T) {
+	fastChunkBackoff(t)
+	jpeg := base64.StdEncoding.EncodeToString([]byte{0xff, 0xd8, 0xff, 0xe0})
+	tests := []struct {
+		name   string
+		fail   map[int]string
+		reject map[string]bool
+		step   string
+	}{
+		{"created", nil, nil, ""},
+		{"create fails", nil, map[string]bool{"create": true}, StepCreatePlaylist},
+		{"tracks fail", map[int]string{1: "reject"}, nil, StepAddTracks},
+		{"image fails", nil, map[string]bool{"image": true}, StepUploadImage},
+		{"rollback fails", map[int]string{0: "reject"}, map[string]bool{"unfollow": true}, StepAddTracks},
+	}
+	for _, tt := range tests {
+		f := newFakePlaylist(t, nil, tt.fail)
+		f.reject = tt.reject
+		pt := &PlaylistTracksBody{Name: "Mine", URIS: testURIs(0, 150), Image: jpeg}
+		p, err := CreatePlaylistSaga(context.Background(), f.api, "tok", "tester", pt)
+		tracks, _, _ := f.state()
+		f.mu.Lock()
+		image, unfollowed := f.image, f.unfollowed
+		f.mu.Unlock()
+		if tt.step == "" {
+			if err != nil || p.ID != "pl" || !slices.Equal(tracks, pt.URIS) || !image || unfollowed {
+				t.Errorf("%s: got %v with %d tracks, image %t, unfollowed %t", tt.name, err, len(tracks), image, unfollowed)
+			}
+			continue
+		}
+		var sagaErr *SagaError
+		if !errors.As(err, &sagaErr) || sagaErr.Step != tt.step {
+			t.Errorf("%s: got %v, want a *SagaError for %s", tt.name, err, tt.step)
+			continue
+		}
+		rb := sagaErr.Rollback
+		switch {
+		case tt.step == StepCreatePlaylist:
+			if rb != nil || unfollowed {
+				t.Errorf("%s: rolled back %+v without a playlist", tt.name, rb)
+			}
+		case rb == nil || rb.PlaylistID != "pl":
+			t.Errorf("%s: got rollback %+v, want one for pl", tt.name, rb)
+		case rb.Done != !tt.reject["unfollow"] || rb.Done != unfollowed || rb.Done != (rb.Error == ""):
+			t.Errorf("%s: got rollback %+v with the playlist unfollowed %t", tt.name, rb, unfollowed)
+		}
+	}
+}
+
+func TestCheckSnapshot(t *testing.T) {
+	p := &spotify.Playlist{}
+	p.ID, p.SnapshotID = "pl", "snap-2"
+	for _, snapshot := range []string{"", "snap-2"} {
+		if err := CheckSnapshot(p, snapshot); err != nil {
+			t.Errorf("CheckSnapshot(%q) = %v", snapshot, err)
+		}
+	}
+	err := CheckSnapshot(p, "snap-1")
+	var pErr *ProblemError
+	if !errors.As(err, &pErr) || pErr.Problem.Status != http.StatusConflict || pErr.Problem.Code != CodePlaylistChanged {
+		t.Errorf("CheckSnapshot(snap-1) = %v, want a %s conflict", err, CodePlaylistChanged)
+	}
+}
+
+func TestValidateRemoveBody(t *testing.T) {
+	uris := testURIs(0, 2)
+	tests := []struct {
+		name string
+		body PlaylistRemoveBody
+		ok   bool
+	}{
+		{"uris", PlaylistRemoveBody{URIS: uris}, true},
+		{"positions", PlaylistRemoveBody{Positions: []int{4, 0}, SnapshotID: "snap"}, true},
+		{"nothing", PlaylistRemoveBody{}, false},
+		{"both", PlaylistRemoveBody{URIS: uris, Positions: []int{0}, SnapshotID: "snap"}, false},
+		{"positions without snapshot", PlaylistRemoveBody{Positions: []int{0}}, false},
+		{"position past the end", PlaylistRemoveBody{Positions: []int{5}, SnapshotID: "snap"}, false},
+		{"position twice", PlaylistRemoveBody{Positions: []int{1, 1}, SnapshotID: "snap"}, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateRemoveBody(&tt.body, 5); (err == nil) != tt.ok {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+	}
+}
+
+func TestTracksAtPositions(t *testing.T) {
+	tracks := testURIs(0, 250)
+	tracks[120] = tracks[3]
+	f := newFakePlaylist(t, tracks, nil)
+	refs, err := TracksAtPositions(context.Background(), f.api, "tok", "pl", []int{3, 201, 120, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []spotify.TrackRef{
+		{URI: tracks[3], Positions: []int{3, 120}},
+		{URI: tracks[201], Positions: []int{201}},
+		{URI: tracks[5], Positions: []int{5}},
+	}
+	_, _, gets := f.state()
+	if fmt.Sprint(refs) != fmt.Sprint(want) || gets != 3 {
+		t.Errorf("got %v from %d pages, want %v from 3", refs, gets, want)
+	}
+	if _, err := TracksAtPositions(context.Background(), f.api, "tok", "pl", []int{260}); err == nil {
+		t.Error("position 260 of 250 tracks was found")
+	}
+}
+
+func TestNewReorder(t *testing.T) {
+	n := func(i int) *int { return &i }
+	tests := []struct {
+		body PlaylistReorderBody
+		want *spotify.Reorder
+	}{
+		{PlaylistReorderBody{RangeStart: n(1), InsertBefore: n(4)}, &spotify.Reorder{RangeStart: 1, InsertBefore: 4, RangeLength: 1}},
+		{PlaylistReorderBody{RangeStart: n(3), InsertBefore: n(0), RangeLength: n(2), SnapshotID: "snap"}, &spotify.Reorder{RangeStart: 3, InsertBefore: 0, RangeLength: 2, SnapshotID: "snap"}},
+		{PlaylistReorderBody{RangeStart: n(0), InsertBefore: n(5)}, &spotify.Reorder{RangeStart: 0, InsertBefore: 5, RangeLength: 1}},
+		{PlaylistReorderBody{InsertBefore: n(0)}, nil},
+		{PlaylistReorderBody{RangeStart: n(5), InsertBefore: n(0)}, nil},
+		{PlaylistReorderBody{RangeStart: n(3), InsertBefore: n(0), RangeLength: n(3)}, nil},
+		{PlaylistReorderBody{RangeStart: n(0), InsertBefore: n(6)}, nil},
+	}
+	for i, tt := range tests {
+		got, err := NewReorder(&tt.body, 5)
+		switch {
+		case tt.want == nil && err == nil:
+			t.Errorf("%d: got %+v, want an error", i, got)
+		case tt.want != nil && (err != nil || got != *tt.want):
+			t.Errorf("%d: got %+v, %v, want %+v", i, got, err, *tt.want)
+		}
+	}
+}
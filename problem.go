@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/getmicah/myapp-api/spotify"
+)
+
+// ProblemContentType : media type of error responses (RFC 7807)
+const ProblemContentType = "application/problem+json"
+
+// error codes : stable, machine-readable reasons sent in a problem's code member
+const (
+	CodeBadRequest         = "bad_request"
+	CodeNotFound           = "not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeUnauthenticated    = "unauthenticated"
+	CodeAuthFailed         = "auth_failed"
+	CodeAuthExpired        = "auth_expired"
+	CodeScopeRequired      = "scope_required"
+	CodeNotPlaylistOwner   = "not_playlist_owner"
+	CodePlaylistChanged    = "playlist_changed"
+	CodeInvalidSeed        = "invalid_seed"
+	CodeInvalidTunable     = "invalid_tunable"
+	CodeSpotifyRateLimited = "spotify_rate_limited"
+	CodeSpotifyForbidden   = "spotify_forbidden"
+	CodeSpotifyUnavailable = "spotify_unavailable"
+	CodeInternal           = "internal_error"
+)
+
+// NewProblem : problem with the given status, error code and human readable detail
+func NewProblem(status int, code string, detail string) Problem {
+	return Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// ProblemError : error that knows the problem it should be reported as
+type ProblemError struct {
+	Problem Problem
+}
+
+func (e *ProblemError) Error() string {
+	return e.Problem.Detail
+}
+
+// BadRequest : ProblemError for a 400 with code
+func BadRequest(code string, format string, args ...interface{}) error {
+	return &ProblemError{Problem: NewProblem(http.StatusBadRequest, code, fmt.Sprintf(format, args...))}
+}
+
+// ErrorProblem : problem carried by err, a bad_request for plain errors
+func ErrorProblem(err error) Problem {
+	var pErr *ProblemError
+	if errors.As(err, &pErr) {
+		return pErr.Problem
+	}
+	return NewProblem(http.StatusBadRequest, CodeBadRequest, err.Error())
+}
+
+// SendError : send an error response back the the user
+func SendError(w http.ResponseWriter, status int, code string, detail string) {
+	SendProblem(w, NewProblem(status, code, detail))
+}
+
+// SendProblem : send p as application/problem+json
+func SendProblem(w http.ResponseWriter, p Problem) {
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if lw, ok := w.(interface{ setError(string) }); ok {
+		lw.setError(p.Code + ": " + p.Detail)
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		body, _ = json.Marshal(NewProblem(http.StatusInternalServerError, CodeInternal, err.Error()))
+		p.Status = http.StatusInternalServerError
+	}
+	if p.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(p.RetryAfter))
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	w.Write(body)
+}
+
+// SpotifyProblem : problem describing a failed Spotify call. Spotify's status is
+// mapped onto ours (outages become 502), its reason is quoted in the detail and
+// its error body, when it sent one, is kept in upstream.
+func SpotifyProblem(err error) Problem {
+	var spErr *spotify.Error
+	if !errors.As(err, &spErr) {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return NewProblem(http.StatusGatewayTimeout, CodeSpotifyUnavailable, "Spotify did not respond in time")
+		}
+		return NewProblem(http.StatusBadGateway, CodeSpotifyUnavailable, err.Error())
+	}
+	var p Problem
+	reason := "Spotify: " + spErr.Error()
+	switch {
+	case spErr.RateLimited():
+		p = NewProblem(http.StatusTooManyRequests, CodeSpotifyRateLimited, reason)
+		p.RetryAfter = spErr.RetrySeconds()
+	case spErr.Status == http.StatusUnauthorized:
+		p = NewProblem(http.StatusUnauthorized, CodeAuthExpired, reason+", log in again")
+	case spErr.Status == http.StatusForbidden:
+		p = NewProblem(http.StatusForbidden, CodeSpotifyForbidden, reason)
+	case spErr.Status == http.StatusNotFound:
+		p = NewProblem(http.StatusNotFound, CodeNotFound, reason)
+	case spErr.Status >= 500:
+		p = NewProblem(http.StatusBadGateway, CodeSpotifyUnavailable, reason)
+	default:
+		p = NewProblem(http.StatusBadRequest, CodeBadRequest, reason)
+	}
+	p.UpstreamStatus = spErr.Status
+	if json.Valid(spErr.Body) {
+		p.Upstream = spErr.Body
+	}
+	return p
+}
+
+// LookupProblem : SpotifyProblem for fetching a single item by id, Spotify's
+// "invalid id" 400s and its 404s both mean the id is unknown
+func LookupProblem(err error, kind string, id string) Problem {
+	p := SpotifyProblem(err)
+	if p.UpstreamStatus == http.StatusBadRequest || p.UpstreamStatus == http.StatusNotFound {
+		p.Status = http.StatusNotFound
+		p.Title = http.StatusText(p.Status)
+		p.Code = CodeNotFound
+		p.Detail = fmt.Sprintf("Unknown %s id %q (%s)", kind, id, p.Detail)
+	}
+	return p
+}
+
+// SendSpotifyError : send a failed Spotify call back to the user
+func SendSpotifyError(w http.ResponseWriter, err error) {
+	SendProblem(w, SpotifyProblem(err))
+}
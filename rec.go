@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getmicah/myapp-api/spotify"
+)
+
+// seedParams : seed query parameters and the item type their ids refer to
+var seedParams = map[string]string{
+	"seed_artists": "artist",
+	"seed_tracks":  "track",
+	"seed_genres":  "genre",
+}
+
+var (
+	spotifyID = regexp.MustCompile(`^[0-9A-Za-z]{22}$`)
+	genreName = regexp.MustCompile(`^[a-z0-9-]+$`)
+)
+
+// ParseRecommendationsQuery : read seeds, tunables and limit from params. Seeds are
+// comma separated ids (or spotify: uris), at most 5 combined; tunables are
+// min_, max_ and target_ attributes within Spotify's ranges. Anything else is rejected.
+func ParseRecommendationsQuery(params url.Values, market string, limit int) (spotify.RecommendationsQuery, error) {
+	q := spotify.RecommendationsQuery{
+		Market:   market,
+		Tunables: make(map[string]float64),
+	}
+	for name := range params {
+		switch name {
+		case "seed_artists", "seed_tracks", "seed_genres", "limit", "market":
+			continue
+		}
+		if err := parseTunable(q.Tunables, name, params.Get(name)); err != nil {
+			return q, err
+		}
+	}
+	if err := checkTunables(q.Tunables); err != nil {
+		return q, err
+	}
+	var err error
+	if q.SeedArtists, err = parseSeeds(params, "seed_artists"); err != nil {
+		return q, err
+	}
+	if q.SeedTracks, err = parseSeeds(params, "seed_tracks"); err != nil {
+		return q, err
+	}
+	if q.SeedGenres, err = parseSeeds(params, "seed_genres"); err != nil {
+		return q, err
+	}
+	if n := q.Seeds(); n == 0 || n > spotify.MaxSeeds {
+		return q, BadRequest(CodeInvalidSeed, "Between 1 and %d seed artists, tracks and genres are required, got %d", spotify.MaxSeeds, n)
+	}
+	if q.Limit, err = QueryInt(params, "limit", limit, 1, spotify.MaxRecommendationsLimit); err != nil {
+		return q, BadRequest(CodeBadRequest, "%v", err)
+	}
+	return q, nil
+}
+
+// parseSeeds : ids in the comma separated seed parameter name, deduplicated
+func parseSeeds(params url.Values, name string) ([]string, error) {
+	kind := seedParams[name]
+	var seeds []string
+	for _, s := range strings.Split(params.Get(name), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if kind == "genre" {
+			s = strings.ToLower(s)
+			if !genreName.MatchString(s) {
+				return nil, BadRequest(CodeInvalidSeed, "%q is not a genre", s)
+			}
+		} else {
+			s = strings.TrimPrefix(s, "spotify:"+kind+":")
+			if !spotifyID.MatchString(s) {
+				return nil, BadRequest(CodeInvalidSeed, "%q is not a Spotify %s id", s, kind)
+			}
+		}
+		if !contains(seeds, s) {
+			seeds = append(seeds, s)
+		}
+	}
+	return seeds, nil
+}
+
+// parseTunable : validate the prefixed attribute name=v and add it to tunables
+func parseTunable(tunables map[string]float64, name string, v string) error {
+	attr := ""
+	for _, prefix := range spotify.TunablePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			attr = strings.TrimPrefix(name, prefix)
+		}
+	}
+	t, ok := spotify.Tunables[attr]
+	if !ok {
+		return BadRequest(CodeBadRequest, "Unknown parameter %q, tunables are min_, max_ or target_ followed by one of %s", name, strings.Join(tunableNames(), ", "))
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || (t.Integer && f != float64(int64(f))) {
+		kind := "a number"
+		if t.Integer {
+			kind = "a whole number"
+		}
+		return BadRequest(CodeInvalidTunable, "%s must be %s", name, kind)
+	}
+	if f < t.Min || f > t.Max {
+		return BadRequest(CodeInvalidTunable, "%s must be from %s to %s", name, formatFloat(t.Min), formatFloat(t.Max))
+	}
+	tunables[name] = f
+	return nil
+}
+
+// checkTunables : every attribute's min <= target <= max
+func checkTunables(tunables map[string]float64) error {
+	for attr := range spotify.Tunables {
+		min, hasMin := tunables["min_"+attr]
+		max, hasMax := tunables["max_"+attr]
+		target, hasTarget := tunables["target_"+attr]
+		if hasMin && hasMax && min > max {
+			return BadRequest(CodeInvalidTunable, "min_%s is greater than max_%s", attr, attr)
+		}
+		if hasTarget && ((hasMin && target < min) || (hasMax && target > max)) {
+			return BadRequest(CodeInvalidTunable, "target_%s is outside min_%s and max_%s", attr, attr, attr)
+		}
+	}
+	return nil
+}
+
+func tunableNames() []string {
+	names := make([]string, 0, len(spotify.Tunables))
+	for name := range spotify.Tunables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// NewRecResponse : normalize Spotify's recommendations into the seeds they were
+// generated from and a flat track list
+func NewRecResponse(q spotify.RecommendationsQuery, res *spotify.Recommendations) RecResponse {
+	rec := RecResponse{
+		Market: q.Market,
+		Seeds:  make([]RecSeed, 0, len(res.Seeds)),
+		Tracks: make([]TrackSummary, 0, len(res.Tracks)),
+	}
+	for _, s := range res.Seeds {
+		rec.Seeds = append(rec.Seeds, RecSeed{
+			ID:   s.ID,
+			Type: strings.ToLower(s.Type),
+			Pool: s.AfterRelinkingSize,
+		})
+	}
+	for _, t := range res.Tracks {
+		rec.Tracks = append(rec.Tracks, NewTrackSummary(t))
+	}
+	return rec
+}
+
+// NewTrackSummary : the parts of a track the frontend shows
+func NewTrackSummary(t spotify.Track) TrackSummary {
+	s := TrackSummary{
+		ID:         t.ID,
+		URI:        t.URI,
+		Name:       t.Name,
+		Artists:    t.Artists,
+		Album:      t.Album.Name,
+		DurationMs: t.DurationMs,
+		Explicit:   t.Explicit,
+		Popularity: t.Popularity,
+		PreviewURL: t.PreviewURL,
+	}
+	if len(t.Album.Images) > 0 {
+		s.Image = t.Album.Images[0].URL
+	}
+	return s
+}
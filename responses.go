@@ -1,5 +1,12 @@
 package main
 
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/getmicah/myapp-api/spotify"
+)
+
 // Token : oauth2 token
 type Token struct {
 	AccessToken  string `json:"access_token"`
@@ -9,39 +16,178 @@ type Token struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-// ErrorResponse : http error response
-type ErrorResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+// Problem : RFC 7807 error response, code and the members after it are extensions
+type Problem struct {
+	Type       string   `json:"type,omitempty"`
+	Title      string   `json:"title"`
+	Status     int      `json:"status"`
+	Detail     string   `json:"detail,omitempty"`
+	Instance   string   `json:"instance,omitempty"`
+	Code       string   `json:"code"`
+	RetryAfter int      `json:"retryAfter,omitempty"`
+	Scopes     []string `json:"scopes,omitempty"`
+	UpgradeURL string   `json:"upgradeUrl,omitempty"`
+	// FailedChunk, TracksAdded : first chunk of tracks that could not be added and
+	// how many tracks were added before it
+	FailedChunk *int `json:"failedChunk,omitempty"`
+	TracksAdded int  `json:"tracksAdded,omitempty"`
+	// Step, Rollback : step of a multi-step operation that failed and how the
+	// steps before it were undone
+	Step     string          `json:"step,omitempty"`
+	Rollback *RollbackReport `json:"rollback,omitempty"`
+	// Suggestions : close matches for an unknown value
+	Suggestions []string `json:"suggestions,omitempty"`
+	// UpstreamStatus, Upstream : status and error body of the failed Spotify call
+	UpstreamStatus int             `json:"upstreamStatus,omitempty"`
+	Upstream       json.RawMessage `json:"upstream,omitempty"`
+}
+
+// RollbackReport : cleanup done after a failed playlist creation
+type RollbackReport struct {
+	PlaylistID string `json:"playlistId"`
+	Action     string `json:"action"`
+	Done       bool   `json:"done"`
+	Error      string `json:"error,omitempty"`
 }
 
 // AuthStatus : spotify authentication status
 type AuthStatus struct {
-	Authenticated bool `json:"authenticated"`
+	Authenticated bool     `json:"authenticated"`
+	Features      []string `json:"features"`
 }
 
-// User : /me spotify response
-type User struct {
-	ID string `json:"id"`
+// SearchResponse : one page of /search results, next and previous are null at the ends
+type SearchResponse struct {
+	Query     string      `json:"query"`
+	Types     []string    `json:"types"`
+	Market    string      `json:"market"`
+	Limit     int         `json:"limit"`
+	Offset    int         `json:"offset"`
+	Next      *string     `json:"next"`
+	Previous  *string     `json:"previous"`
+	Tracks    *SearchPage `json:"tracks,omitempty"`
+	Artists   *SearchPage `json:"artists,omitempty"`
+	Albums    *SearchPage `json:"albums,omitempty"`
+	Playlists *SearchPage `json:"playlists,omitempty"`
 }
 
-// PlaylistBody : post body for spotify playlist
-type PlaylistBody struct {
-	Name string `json:"name"`
+// SearchPage : results of one type on a /search page
+type SearchPage struct {
+	Total int         `json:"total"`
+	Items interface{} `json:"items"`
 }
 
-// PlaylistResponse : spotify playlist
-type PlaylistResponse struct {
-	ID string `json:"id"`
+// TopTracks : /artist/top-tracks response
+type TopTracks struct {
+	Market string          `json:"market"`
+	Tracks []spotify.Track `json:"tracks"`
 }
 
-// PlaylistTracksBody : post tracks to playlist
+// RecResponse : /rec response
+type RecResponse struct {
+	Market string         `json:"market"`
+	Seeds  []RecSeed      `json:"seeds"`
+	Tracks []TrackSummary `json:"tracks"`
+}
+
+// RecSeed : seed recommendations were generated from, pool is how many
+// candidate tracks it contributed
+type RecSeed struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Pool int    `json:"pool"`
+}
+
+// GenresResponse : /genres response
+type GenresResponse struct {
+	Genres    []string  `json:"genres"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// TrackSummary : normalized track
+type TrackSummary struct {
+	ID         string                 `json:"id"`
+	URI        string                 `json:"uri"`
+	Name       string                 `json:"name"`
+	Artists    []spotify.SimpleArtist `json:"artists"`
+	Album      string                 `json:"album"`
+	Image      string                 `json:"image,omitempty"`
+	DurationMs int                    `json:"durationMs"`
+	Explicit   bool                   `json:"explicit"`
+	Popularity int                    `json:"popularity"`
+	PreviewURL string                 `json:"previewUrl,omitempty"`
+}
+
+// PlaylistTracksBody : post tracks to playlist. Name defaults to one built from
+// the seed names, public defaults to true and image is a base64 JPEG cover.
 type PlaylistTracksBody struct {
-	URIS []string `json:"uris"`
+	Name          string   `json:"name"`
+	Description   string   `json:"description"`
+	Public        *bool    `json:"public"`
+	Collaborative bool     `json:"collaborative"`
+	Image         string   `json:"image"`
+	Seeds         []string `json:"seeds"`
+	URIS          []string `json:"uris"`
+}
+
+// IsPublic : whether the playlist is created public
+func (pt *PlaylistTracksBody) IsPublic() bool {
+	return pt.Public == nil || *pt.Public
+}
+
+// PlaylistEditBody : tracks for PUT and POST /playlist/{id}/tracks, position is
+// where POST inserts them (appended when absent)
+type PlaylistEditBody struct {
+	URIS     []string `json:"uris"`
+	Position *int     `json:"position"`
+}
+
+// PlaylistRemoveBody : tracks for DELETE /playlist/{id}/tracks, either every
+// occurrence of uris or the tracks at positions of snapshotId
+type PlaylistRemoveBody struct {
+	URIS       []string `json:"uris"`
+	Positions  []int    `json:"positions"`
+	SnapshotID string   `json:"snapshotId"`
+}
+
+// PlaylistReorderBody : range for PATCH /playlist/{id}/tracks, rangeLength tracks
+// from rangeStart move to before insertBefore
+type PlaylistReorderBody struct {
+	RangeStart   *int   `json:"rangeStart"`
+	InsertBefore *int   `json:"insertBefore"`
+	RangeLength  *int   `json:"rangeLength"`
+	SnapshotID   string `json:"snapshotId"`
+}
+
+// PlaylistSnapshot : playlist version after its tracks changed, total is left out
+// when unknown
+type PlaylistSnapshot struct {
+	ID         string `json:"id"`
+	SnapshotID string `json:"snapshotId"`
+	Total      *int   `json:"total,omitempty"`
 }
 
 // PlaylistReturnJSON : return data for frontend
 type PlaylistReturnJSON struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	Name          string `json:"name"`
+	Public        bool   `json:"public"`
+	Collaborative bool   `json:"collaborative"`
+	URL           string `json:"url,omitempty"`
+}
+
+// HealthStatus : /healthz and /readyz response
+type HealthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// BuildInfo : /version response
+type BuildInfo struct {
+	Version   string `json:"version,omitempty"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"goVersion"`
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Router : routes requests by method and path, answering unknown paths with
+// 404 and known paths requested with the wrong method with 405 and Allow
+type Router struct {
+	mux     *http.ServeMux
+	methods map[string][]string
+}
+
+// NewRouter : create an empty router
+func NewRouter() *Router {
+	rt := &Router{
+		mux:     http.NewServeMux(),
+		methods: make(map[string][]string),
+	}
+	rt.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Endpoint not found")
+	})
+	return rt
+}
+
+// Handle : register h for method requests to path, path may contain {wildcards}
+func (rt *Router) Handle(method string, path string, h http.Handler) {
+	if _, ok := rt.methods[path]; !ok {
+		rt.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			SendMethodNotAllowed(w, r.Method, rt.allowed(path))
+		})
+	}
+	rt.methods[path] = append(rt.methods[path], method)
+	rt.mux.Handle(method+" "+path, h)
+}
+
+// HandleFunc : register f for method requests to path
+func (rt *Router) HandleFunc(method string, path string, f http.HandlerFunc) {
+	rt.Handle(method, path, f)
+}
+
+// Route : path pattern the request matches, e.g. "/search", empty for unknown paths
+func (rt *Router) Route(r *http.Request) string {
+	_, pattern := rt.mux.Handler(r)
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	if pattern == "/" {
+		return ""
+	}
+	return pattern
+}
+
+// Method : the request method if any route accepts it (HEAD with GET, OPTIONS for
+// CORS preflights), otherwise "other", so labels can't be made up by clients
+func (rt *Router) Method(r *http.Request) string {
+	switch r.Method {
+	case http.MethodHead, http.MethodOptions:
+		return r.Method
+	}
+	for _, methods := range rt.methods {
+		for _, m := range methods {
+			if m == r.Method {
+				return m
+			}
+		}
+	}
+	return "other"
+}
+
+func (rt *Router) allowed(path string) []string {
+	methods := append([]string{}, rt.methods[path]...)
+	for _, m := range rt.methods[path] {
+		if m == http.MethodGet {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// SendMethodNotAllowed : send a 405 listing the allowed methods
+func SendMethodNotAllowed(w http.ResponseWriter, method string, allowed []string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	SendError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Endpoint doesn't support "+method+" request")
+}
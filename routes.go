@@ -1,122 +1,146 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
+
+	"github.com/getmicah/myapp-api/spotify"
 )
 
 // LoginHandler : /auth/login
 type LoginHandler struct {
-	clientID        string
-	redirectURI     string
-	scope           []string
-	authStateCookie CookieID
+	clientID           string
+	redirectURI        string
+	features           []string
+	pkce               bool
+	authStateCookie    CookieID
+	authVerifierCookie CookieID
+	sessionCookie      CookieID
+	sessions           SessionStore
 }
 
-func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "GET":
-		fmt.Println("GET /login")
-		loginGet(w, r, h)
-	default:
-		SendBadRequest(w, r.Method)
+func (h *LoginHandler) get(w http.ResponseWriter, r *http.Request) {
+	features, err := ParseFeatures(r.URL.Query().Get("features"))
+	if err != nil {
+		SendError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
 	}
-}
-
-func loginGet(w http.ResponseWriter, r *http.Request, h *LoginHandler) {
+	// keep whatever the current session was already granted when upgrading
+	var granted []string
+	if id, err := ReadCookie(r, h.sessionCookie); err == nil {
+		if session, err := h.sessions.Get(r.Context(), id); err == nil {
+			granted = session.Scopes
+		}
+	}
+	scope := FeatureScopes(append(features, h.features...), granted)
 	dur := 3600 * time.Second
 	state := GenerateRandomString(16)
 	expiry := time.Now().Add(dur)
 	if err := WriteCookie(w, h.authStateCookie, state, expiry); err != nil {
-		SendError(w, http.StatusInternalServerError, err.Error())
+		SendError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
 	}
 	api := "https://accounts.spotify.com/authorize/"
 	authURL := fmt.Sprintf(
 		"%s?client_id=%s&response_type=%s&redirect_uri=%s&scope=%s&state=%s",
-		api, h.clientID, "code", url.PathEscape(h.redirectURI), strings.Join(h.scope[:], "%20"), state,
+		api, h.clientID, "code", url.PathEscape(h.redirectURI), strings.Join(scope, "%20"), state,
 	)
+	if h.pkce {
+		verifier := NewCodeVerifier()
+		if err := WriteCookie(w, h.authVerifierCookie, verifier, expiry); err != nil {
+			SendError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		authURL += fmt.Sprintf("&code_challenge_method=S256&code_challenge=%s", CodeChallenge(verifier))
+	}
 	http.Redirect(w, r, authURL, 302)
 }
 
 // CallbackHandler : /auth/callback
 type CallbackHandler struct {
+	api                *spotify.Client
 	authStateCookie    CookieID
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
+	authVerifierCookie CookieID
+	sessionCookie      CookieID
+	sessions           SessionStore
 	clientID           string
 	clientSecret       string
 	redirectURI        string
 	appURL             string
+	pkce               bool
 }
 
-func (h *CallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "GET":
-		fmt.Println("GET /callback")
-		callbackGet(w, r, h)
-	default:
-		SendBadRequest(w, r.Method)
-	}
-}
-
-func callbackGet(w http.ResponseWriter, r *http.Request, h *CallbackHandler) {
+func (h *CallbackHandler) get(w http.ResponseWriter, r *http.Request) {
 	originalState, err := ReadCookie(r, h.authStateCookie)
 	if err != nil {
-		SendError(w, http.StatusInternalServerError, err.Error())
+		SendError(w, http.StatusUnauthorized, CodeAuthFailed, err.Error())
 		return
 	}
 	newState := r.URL.Query().Get("state")
 	if newState != originalState {
-		SendError(w, http.StatusUnauthorized, "Auth state compormised")
+		SendError(w, http.StatusUnauthorized, CodeAuthFailed, "Auth state compormised")
 		return
 	}
 	callbackErr := r.URL.Query().Get("error")
 	if callbackErr != "" {
-		SendError(w, http.StatusUnauthorized, callbackErr)
+		SendError(w, http.StatusUnauthorized, CodeAuthFailed, callbackErr)
 		return
 	}
+	verifier := ""
+	if h.pkce {
+		verifier, err = ReadCookie(r, h.authVerifierCookie)
+		if err != nil {
+			SendError(w, http.StatusUnauthorized, CodeAuthFailed, err.Error())
+			return
+		}
+	}
 	code := r.URL.Query().Get("code")
-	token, err := RequestOAuthToken(r, code, h.redirectURI, h.clientID, h.clientSecret)
+	token, err := RequestOAuthToken(r, code, verifier, h.redirectURI, h.clientID, h.clientSecret)
+	if err != nil {
+		SendProblem(w, AuthProblem(err, CodeAuthFailed))
+		return
+	}
+	me, err := h.api.Me(r.Context(), token.AccessToken)
 	if err != nil {
-		SendError(w, http.StatusUnauthorized, err.Error())
+		SendSpotifyError(w, err)
+		return
+	}
+	// a scope upgrade replaces the session it was started from
+	if err := EndSession(r, h.sessions, h.sessionCookie); err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
+	}
+	if err := StartSession(w, r, h.sessions, h.sessionCookie, token, me); err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, err.Error())
 		return
 	}
-	accessTokenExpiry := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
-	yearExpiry := time.Now().Add(365 * 24 * time.Hour)
-	WriteCookie(w, h.accessTokenCookie, token.AccessToken, accessTokenExpiry)
-	WriteCookie(w, h.refreshTokenCookie, token.RefreshToken, yearExpiry)
-	WriteCookie(w, h.tokenExpiryCookie, accessTokenExpiry.Format(TimeLayout), yearExpiry)
 	ClearCookie(w, h.authStateCookie)
+	if h.pkce {
+		ClearCookie(w, h.authVerifierCookie)
+	}
 	http.Redirect(w, r, h.appURL, 302)
 }
 
 // LogoutHandler : /auth/logout
 type LogoutHandler struct {
-	cookies []CookieID
-	appURL  string
+	cookies       []CookieID
+	sessionCookie CookieID
+	sessions      SessionStore
+	appURL        string
 }
 
-func (h *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "GET":
-		fmt.Println("GET /logout")
-		logoutGet(w, r, h)
-	default:
-		SendBadRequest(w, r.Method)
+func (h *LogoutHandler) get(w http.ResponseWriter, r *http.Request) {
+	if err := EndSession(r, h.sessions, h.sessionCookie); err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
 	}
-}
-
-func logoutGet(w http.ResponseWriter, r *http.Request, h *LogoutHandler) {
 	for i := 0; i < len(h.cookies); i++ {
 		if err := ClearCookie(w, h.cookies[i]); err != nil {
-			SendError(w, http.StatusInternalServerError, err.Error())
+			SendError(w, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 	}
@@ -125,276 +149,389 @@ func logoutGet(w http.ResponseWriter, r *http.Request, h *LogoutHandler) {
 
 // AuthHandler : /auth
 type AuthHandler struct {
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
-	clientID           string
-	clientSecret       string
-}
-
-func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "GET":
-		fmt.Println("GET /auth")
-		authGet(w, r, h)
-	default:
-		SendBadRequest(w, r.Method)
-	}
 }
 
-func authGet(w http.ResponseWriter, r *http.Request, h *AuthHandler) {
-	_, err := LoadAccessToken(w, r, h.accessTokenCookie, h.refreshTokenCookie, h.tokenExpiryCookie, h.clientID, h.clientSecret)
-	if err != nil {
-		SendError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
-	w.WriteHeader(http.StatusOK)
+func (h *AuthHandler) get(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r.Context())
+	SendJSON(w, http.StatusOK, AuthStatus{
+		Authenticated: true,
+		Features:      GrantedFeatures(session.Scopes),
+	})
 }
 
 // SearchHandler : /search
 type SearchHandler struct {
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
-	clientID           string
-	clientSecret       string
-}
-
-func (h *SearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "GET":
-		fmt.Println("GET /search")
-		searchGet(w, r, h)
-	default:
-		SendBadRequest(w, r.Method)
-	}
-
+	apiURL string
+	market string
+	limit  int
+	api    *spotify.Client
 }
 
-func searchGet(w http.ResponseWriter, r *http.Request, h *SearchHandler) {
-	accessToken, err := LoadAccessToken(w, r, h.accessTokenCookie, h.refreshTokenCookie, h.tokenExpiryCookie, h.clientID, h.clientSecret)
+func (h *SearchHandler) get(w http.ResponseWriter, r *http.Request) {
+	accessToken := AccessToken(r.Context())
+	market, err := RequestMarket(r, h.market)
 	if err != nil {
-		SendError(w, http.StatusUnauthorized, err.Error())
+		SendError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
 		return
 	}
-	q := r.URL.Query().Get("q")
-	searchType := r.URL.Query().Get("type")
-	limit := 5
-	api := fmt.Sprintf("/search?q=%s&type=%s&limit=%d&market=US", url.PathEscape(q), searchType, limit)
-	res, err := SpotifyGet(r, api, accessToken)
+	q, err := ParseSearchQuery(r.URL.Query(), market, h.limit)
 	if err != nil {
-		SendError(w, http.StatusBadRequest, err.Error())
+		SendError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
 		return
 	}
-	body, err := ioutil.ReadAll(res.Body)
+	res, err := h.api.Search(r.Context(), accessToken, q)
 	if err != nil {
-		SendError(w, http.StatusInternalServerError, err.Error())
+		SendSpotifyError(w, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(body)
+	SendJSON(w, http.StatusOK, NewSearchResponse(h.apiURL, q, res))
 }
 
-// ArtistHandler : /artist
+// ArtistHandler : /artist, /artist/top-tracks
 type ArtistHandler struct {
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
-	clientID           string
-	clientSecret       string
+	market string
+	api    *spotify.Client
 }
 
-func (h *ArtistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "GET":
-		fmt.Println("GET /artist")
-		artistGet(w, r, h)
-	default:
-		SendBadRequest(w, r.Method)
+func (h *ArtistHandler) get(w http.ResponseWriter, r *http.Request) {
+	accessToken := AccessToken(r.Context())
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		SendError(w, http.StatusBadRequest, CodeBadRequest, "Missing artist id")
+		return
 	}
-
-}
-
-func artistGet(w http.ResponseWriter, r *http.Request, h *ArtistHandler) {
-	accessToken, err := LoadAccessToken(w, r, h.accessTokenCookie, h.refreshTokenCookie, h.tokenExpiryCookie, h.clientID, h.clientSecret)
+	res, err := h.api.GetArtist(r.Context(), accessToken, id)
 	if err != nil {
-		SendError(w, http.StatusUnauthorized, err.Error())
+		SendProblem(w, LookupProblem(err, "artist", id))
 		return
 	}
+	SendJSON(w, http.StatusOK, res)
+}
+
+func (h *ArtistHandler) topTracks(w http.ResponseWriter, r *http.Request) {
+	accessToken := AccessToken(r.Context())
 	id := r.URL.Query().Get("id")
-	endpoint := fmt.Sprintf("/artists/%s", id)
-	res, err := SpotifyGet(r, endpoint, accessToken)
+	if id == "" {
+		SendError(w, http.StatusBadRequest, CodeBadRequest, "Missing artist id")
+		return
+	}
+	market, err := RequestMarket(r, h.market)
 	if err != nil {
-		SendError(w, http.StatusBadRequest, err.Error())
+		SendError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
 		return
 	}
-	body, err := ioutil.ReadAll(res.Body)
+	res, err := h.api.GetArtistTopTracks(r.Context(), accessToken, id, market)
 	if err != nil {
-		SendError(w, http.StatusInternalServerError, err.Error())
+		SendProblem(w, LookupProblem(err, "artist", id))
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(body)
+	SendJSON(w, http.StatusOK, TopTracks{Market: market, Tracks: res})
 }
 
 // TrackHandler : /track
 type TrackHandler struct {
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
-	clientID           string
-	clientSecret       string
+	market string
+	api    *spotify.Client
 }
 
-func (h *TrackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "GET":
-		fmt.Println("GET /track")
-		trackGet(w, r, h)
-	default:
-		SendBadRequest(w, r.Method)
-	}
-
-}
-
-func trackGet(w http.ResponseWriter, r *http.Request, h *TrackHandler) {
-	accessToken, err := LoadAccessToken(w, r, h.accessTokenCookie, h.refreshTokenCookie, h.tokenExpiryCookie, h.clientID, h.clientSecret)
-	if err != nil {
-		SendError(w, http.StatusUnauthorized, err.Error())
+func (h *TrackHandler) get(w http.ResponseWriter, r *http.Request) {
+	accessToken := AccessToken(r.Context())
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		SendError(w, http.StatusBadRequest, CodeBadRequest, "Missing track id")
 		return
 	}
-	id := r.URL.Query().Get("id")
-	endpoint := fmt.Sprintf("/tracks/%s", id)
-	res, err := SpotifyGet(r, endpoint, accessToken)
+	market, err := RequestMarket(r, h.market)
 	if err != nil {
-		SendError(w, http.StatusBadRequest, err.Error())
+		SendError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
 		return
 	}
-	body, err := ioutil.ReadAll(res.Body)
+	res, err := h.api.GetTrack(r.Context(), accessToken, id, market)
 	if err != nil {
-		SendError(w, http.StatusInternalServerError, err.Error())
+		SendProblem(w, LookupProblem(err, "track", id))
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(body)
+	SendJSON(w, http.StatusOK, res)
 }
 
-// RecHandler : /rec
-type RecHandler struct {
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
-	clientID           string
-	clientSecret       string
+// GenresHandler : /genres, ?refresh=true fetches the list again unless it is
+// younger than a minute
+type GenresHandler struct {
+	genres *GenreCache
 }
 
-func (h *RecHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "GET":
-		fmt.Println("GET /rec")
-		recGet(w, r, h)
-	default:
-		SendBadRequest(w, r.Method)
+func (h *GenresHandler) get(w http.ResponseWriter, r *http.Request) {
+	refresh := r.URL.Query().Get("refresh") == "true"
+	genres, at, err := h.genres.Genres(r.Context(), AccessToken(r.Context()), refresh)
+	if err != nil {
+		SendSpotifyError(w, err)
+		return
 	}
+	SendJSON(w, http.StatusOK, GenresResponse{Genres: genres, FetchedAt: at})
+}
 
+// RecHandler : /rec
+type RecHandler struct {
+	market string
+	limit  int
+	genres *GenreCache
+	api    *spotify.Client
 }
 
-func recGet(w http.ResponseWriter, r *http.Request, h *RecHandler) {
-	accessToken, err := LoadAccessToken(w, r, h.accessTokenCookie, h.refreshTokenCookie, h.tokenExpiryCookie, h.clientID, h.clientSecret)
+func (h *RecHandler) get(w http.ResponseWriter, r *http.Request) {
+	accessToken := AccessToken(r.Context())
+	market, err := RequestMarket(r, h.market)
 	if err != nil {
-		SendError(w, http.StatusUnauthorized, err.Error())
+		SendError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
 		return
 	}
-	url := fmt.Sprintf("/recommendations?market=US&limit=30&%s", r.URL.RawQuery)
-	res, err := SpotifyGet(r, url, accessToken)
+	q, err := ParseRecommendationsQuery(r.URL.Query(), market, h.limit)
 	if err != nil {
-		SendError(w, http.StatusBadRequest, err.Error())
+		SendProblem(w, ErrorProblem(err))
 		return
 	}
-	body, err := ioutil.ReadAll(res.Body)
+	if len(q.SeedGenres) > 0 {
+		// without the genre list Spotify is left to reject unknown genres
+		if genres, _, err := h.genres.Genres(r.Context(), accessToken, false); err == nil {
+			if err := CheckGenres(q.SeedGenres, genres); err != nil {
+				SendProblem(w, ErrorProblem(err))
+				return
+			}
+		}
+	}
+	res, err := h.api.GetRecommendations(r.Context(), accessToken, q)
 	if err != nil {
-		SendError(w, http.StatusInternalServerError, err.Error())
+		// Spotify answers unknown seeds with 400/404
+		p := SpotifyProblem(err)
+		if p.Status == http.StatusBadRequest || p.Status == http.StatusNotFound {
+			p.Status = http.StatusBadRequest
+			p.Title = http.StatusText(p.Status)
+			p.Code = CodeInvalidSeed
+		}
+		SendProblem(w, p)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(body)
+	SendJSON(w, http.StatusOK, NewRecResponse(q, res))
 }
 
-// PlaylistHandler : /playlist
+// PlaylistHandler : /playlist, /playlist/{id}/tracks
 type PlaylistHandler struct {
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
-	clientID           string
-	clientSecret       string
+	apiURL string
+	api    *spotify.Client
 }
 
-func (h *PlaylistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		fmt.Println("POST /playlist")
-		playlistPost(w, r, h)
-	default:
-		SendBadRequest(w, r.Method)
+func (h *PlaylistHandler) post(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r.Context())
+	accessToken := session.Token.AccessToken
+
+	// read playlist options and tracks from body (pt = playlist tracks)
+	pt, err := DecodePlaylistBody(r.Body, time.Now())
+	if err != nil {
+		SendProblem(w, ErrorProblem(err))
+		return
+	}
+	feature := "playlists"
+	if !pt.IsPublic() {
+		feature = "private_playlists"
+	}
+	if !RequireFeature(w, session, h.apiURL, feature) {
+		return
+	}
+	if pt.Image != "" && !RequireFeature(w, session, h.apiURL, "playlist_images") {
+		return
+	}
+
+	// create the playlist with its tracks and cover, removing it again on failure
+	playlist, err := CreatePlaylistSaga(r.Context(), h.api, accessToken, session.User.ID, pt)
+	if err != nil {
+		SendProblem(w, SagaProblem(err))
+		return
 	}
 
+	// create return object
+	p := PlaylistReturnJSON{
+		ID:            playlist.ID,
+		Username:      session.User.ID,
+		Name:          playlist.Name,
+		Public:        pt.IsPublic(),
+		Collaborative: pt.Collaborative,
+		URL:           playlist.ExternalURLs["spotify"],
+	}
+	SendJSON(w, http.StatusOK, p)
 }
 
-func playlistPost(w http.ResponseWriter, r *http.Request, h *PlaylistHandler) {
-	// get user access token
-	accessToken, err := LoadAccessToken(w, r, h.accessTokenCookie, h.refreshTokenCookie, h.tokenExpiryCookie, h.clientID, h.clientSecret)
+// editable : the playlist named in the path if the session user may change its
+// tracks, otherwise the error is sent and ok is false
+func (h *PlaylistHandler) editable(w http.ResponseWriter, r *http.Request) (*spotify.Playlist, bool) {
+	session := CurrentSession(r.Context())
+	id := r.PathValue("id")
+	playlist, err := EditablePlaylist(r.Context(), h.api, session.Token.AccessToken, session.User.ID, id)
 	if err != nil {
-		SendError(w, http.StatusUnauthorized, err.Error())
-		return
+		var pErr *ProblemError
+		if errors.As(err, &pErr) {
+			SendProblem(w, pErr.Problem)
+		} else {
+			SendProblem(w, LookupProblem(err, "playlist", id))
+		}
+		return nil, false
 	}
+	feature := "playlists"
+	if !playlist.Public {
+		feature = "private_playlists"
+	}
+	if !RequireFeature(w, session, h.apiURL, feature) {
+		return nil, false
+	}
+	return playlist, true
+}
 
-	// get user id
-	meRes, err := SpotifyGet(r, "/me", accessToken)
+// replaceTracks : PUT /playlist/{id}/tracks, replace every track keeping the body's order
+func (h *PlaylistHandler) replaceTracks(w http.ResponseWriter, r *http.Request) {
+	accessToken := AccessToken(r.Context())
+	var pe PlaylistEditBody
+	err := DecodeEditBody(r.Body, &pe)
+	if err == nil && pe.URIS == nil {
+		err = BadRequest(CodeBadRequest, "uris is required, send [] to remove every track")
+	}
+	if err == nil && pe.Position != nil {
+		err = BadRequest(CodeBadRequest, "position is only accepted when appending")
+	}
+	if err == nil && len(pe.URIS) > 0 {
+		err = ValidateTrackURIs(pe.URIS, spotify.MaxPlaylistTracks)
+	}
 	if err != nil {
-		SendError(w, http.StatusBadRequest, err.Error())
+		SendProblem(w, ErrorProblem(err))
 		return
 	}
-	var me User
-	json.NewDecoder(meRes.Body).Decode(&me)
-
-	// create user playlist
-	userPlaylistEndpoint := fmt.Sprintf("/users/%s/playlists", me.ID)
-	var pb PlaylistBody
-	pb.Name = "Your new playlist!"
-	playlistReqBody := new(bytes.Buffer)
-	json.NewEncoder(playlistReqBody).Encode(pb)
-	playlistReq, err := SpotifyPost(r, userPlaylistEndpoint, playlistReqBody, accessToken)
+	playlist, ok := h.editable(w, r)
+	if !ok {
+		return
+	}
+	snapshot, err := ReplaceTracksInChunks(r.Context(), h.api, accessToken, playlist.ID, pe.URIS)
 	if err != nil {
-		SendError(w, http.StatusBadRequest, err.Error())
+		SendProblem(w, ChunkProblem(err))
 		return
 	}
+	total := len(pe.URIS)
+	SendJSON(w, http.StatusOK, PlaylistSnapshot{ID: playlist.ID, SnapshotID: snapshot, Total: &total})
+}
 
-	// add tracks from body to playlist (pt = playlist tracks)
-	var playlistResponse PlaylistResponse
-	json.NewDecoder(playlistReq.Body).Decode(&playlistResponse)
-	ptEndpoint := fmt.Sprintf("/users/%s/playlists/%s/tracks", me.ID, playlistResponse.ID)
-	_, postErr := SpotifyPost(r, ptEndpoint, r.Body, accessToken)
-	if postErr != nil {
-		SendError(w, http.StatusBadRequest, err.Error())
+// appendTracks : POST /playlist/{id}/tracks, add tracks at the end or before position
+func (h *PlaylistHandler) appendTracks(w http.ResponseWriter, r *http.Request) {
+	accessToken := AccessToken(r.Context())
+	var pe PlaylistEditBody
+	err := DecodeEditBody(r.Body, &pe)
+	if err == nil {
+		err = ValidateTrackURIs(pe.URIS, spotify.MaxPlaylistTracks)
+	}
+	if err != nil {
+		SendProblem(w, ErrorProblem(err))
+		return
+	}
+	playlist, ok := h.editable(w, r)
+	if !ok {
+		return
+	}
+	total := playlist.Tracks.Total
+	if total+len(pe.URIS) > spotify.MaxPlaylistTracks {
+		SendError(w, http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("Playlist holds %d tracks, adding %d would pass Spotify's limit of %d", total, len(pe.URIS), spotify.MaxPlaylistTracks))
+		return
+	}
+	position := -1
+	if pe.Position != nil {
+		position = *pe.Position
+		if position < 0 || position > total {
+			SendError(w, http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("position must be from 0 to %d", total))
+			return
+		}
+	}
+	snapshot, err := AddTracksInChunks(r.Context(), h.api, accessToken, playlist.ID, pe.URIS, total, position, playlist.SnapshotID)
+	if err != nil {
+		SendProblem(w, ChunkProblem(err))
 		return
 	}
+	total += len(pe.URIS)
+	SendJSON(w, http.StatusOK, PlaylistSnapshot{ID: playlist.ID, SnapshotID: snapshot, Total: &total})
+}
 
-	// create return object
-	p := PlaylistReturnJSON{
-		ID:       playlistResponse.ID,
-		Username: me.ID,
+// removeTracks : DELETE /playlist/{id}/tracks, remove every occurrence of uris or
+// the tracks at positions
+func (h *PlaylistHandler) removeTracks(w http.ResponseWriter, r *http.Request) {
+	accessToken := AccessToken(r.Context())
+	var pr PlaylistRemoveBody
+	if err := DecodeEditBody(r.Body, &pr); err != nil {
+		SendProblem(w, ErrorProblem(err))
+		return
+	}
+	playlist, ok := h.editable(w, r)
+	if !ok {
+		return
+	}
+	err := CheckSnapshot(playlist, pr.SnapshotID)
+	if err == nil {
+		err = ValidateRemoveBody(&pr, playlist.Tracks.Total)
+	}
+	if err != nil {
+		SendProblem(w, ErrorProblem(err))
+		return
+	}
+	var tracks []spotify.TrackRef
+	if len(pr.Positions) > 0 {
+		if tracks, err = TracksAtPositions(r.Context(), h.api, accessToken, playlist.ID, pr.Positions); err != nil {
+			var pErr *ProblemError
+			if errors.As(err, &pErr) {
+				SendProblem(w, pErr.Problem)
+			} else {
+				SendSpotifyError(w, err)
+			}
+			return
+		}
+	} else {
+		for _, uri := range pr.URIS {
+			tracks = append(tracks, spotify.TrackRef{URI: uri})
+		}
 	}
-	playlistJSON, err := json.Marshal(p)
+	snapshot, err := h.api.RemoveTracks(r.Context(), accessToken, playlist.ID, tracks, pr.SnapshotID)
 	if err != nil {
-		SendError(w, http.StatusInternalServerError, err.Error())
+		SendSpotifyError(w, err)
 		return
 	}
+	res := PlaylistSnapshot{ID: playlist.ID, SnapshotID: snapshot}
+	// removing uris drops however many times they occur, which Spotify doesn't report
+	if len(pr.Positions) > 0 {
+		total := playlist.Tracks.Total - len(pr.Positions)
+		res.Total = &total
+	}
+	SendJSON(w, http.StatusOK, res)
+}
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(playlistJSON)
+// reorderTracks : PATCH /playlist/{id}/tracks, move rangeLength tracks from
+// rangeStart to before insertBefore
+func (h *PlaylistHandler) reorderTracks(w http.ResponseWriter, r *http.Request) {
+	accessToken := AccessToken(r.Context())
+	var pr PlaylistReorderBody
+	if err := DecodeEditBody(r.Body, &pr); err != nil {
+		SendProblem(w, ErrorProblem(err))
+		return
+	}
+	playlist, ok := h.editable(w, r)
+	if !ok {
+		return
+	}
+	err := CheckSnapshot(playlist, pr.SnapshotID)
+	var ro spotify.Reorder
+	if err == nil {
+		ro, err = NewReorder(&pr, playlist.Tracks.Total)
+	}
+	if err != nil {
+		SendProblem(w, ErrorProblem(err))
+		return
+	}
+	snapshot, err := h.api.ReorderTracks(r.Context(), accessToken, playlist.ID, ro)
+	if err != nil {
+		SendSpotifyError(w, err)
+		return
+	}
+	total := playlist.Tracks.Total
+	SendJSON(w, http.StatusOK, PlaylistSnapshot{ID: playlist.ID, SnapshotID: snapshot, Total: &total})
 }
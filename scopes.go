@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Features : spotify scopes needed by each feature the frontend can ask for
+var Features = map[string][]string{
+	"playlists":         {"playlist-modify-public"},
+	"private_playlists": {"playlist-modify-private"},
+	"library":           {"user-library-read", "user-library-modify"},
+	"top":               {"user-top-read"},
+	"profile":           {"user-read-private"},
+	"playlist_images":   {"ugc-image-upload"},
+}
+
+// DefaultFeatures : features requested by every login, profile gives us the
+// user's country to use as their market
+var DefaultFeatures = []string{"playlists", "profile"}
+
+// ParseFeatures : parse a comma separated feature list, rejecting unknown features
+func ParseFeatures(raw string) ([]string, error) {
+	var features []string
+	for _, f := range strings.Split(raw, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if _, ok := Features[f]; !ok {
+			return nil, fmt.Errorf("Unknown feature %q", f)
+		}
+		features = append(features, f)
+	}
+	return features, nil
+}
+
+// FeatureScopes : union of the scopes needed by features and the extra scopes
+func FeatureScopes(features []string, extra []string) []string {
+	set := make(map[string]bool)
+	for _, f := range features {
+		for _, s := range Features[f] {
+			set[s] = true
+		}
+	}
+	for _, s := range extra {
+		set[s] = true
+	}
+	scopes := make([]string, 0, len(set))
+	for s := range set {
+		scopes = append(scopes, s)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// HasScopes : whether every scope is in granted
+func HasScopes(granted []string, scopes []string) bool {
+	for _, s := range scopes {
+		found := false
+		for _, g := range granted {
+			if g == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// GrantedFeatures : features whose scopes are all in granted
+func GrantedFeatures(granted []string) []string {
+	features := []string{}
+	for f, scopes := range Features {
+		if HasScopes(granted, scopes) {
+			features = append(features, f)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
+
+// ScopeUpgradeURL : login url that asks the user to grant feature
+func ScopeUpgradeURL(apiURL string, feature string) string {
+	return fmt.Sprintf("%s/auth/login?features=%s", strings.TrimRight(apiURL, "/"), url.QueryEscape(feature))
+}
+
+// RequireFeature : send a scope_required error and return false when the session
+// was not granted every scope feature needs
+func RequireFeature(w http.ResponseWriter, session *Session, apiURL string, feature string) bool {
+	if HasScopes(session.Scopes, Features[feature]) {
+		return true
+	}
+	p := NewProblem(http.StatusForbidden, CodeScopeRequired, fmt.Sprintf("Feature %s needs additional Spotify permissions", feature))
+	p.Scopes = Features[feature]
+	p.UpgradeURL = ScopeUpgradeURL(apiURL, feature)
+	SendProblem(w, p)
+	return false
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/getmicah/myapp-api/spotify"
+)
+
+// ParseSearchQuery : read q, type, limit and offset from params, checked against
+// Spotify's bounds. type is a comma separated list and defaults to track.
+func ParseSearchQuery(params url.Values, market string, limit int) (spotify.SearchQuery, error) {
+	q := spotify.SearchQuery{
+		Q:      strings.TrimSpace(params.Get("q")),
+		Market: market,
+	}
+	if q.Q == "" {
+		return q, fmt.Errorf("q is required")
+	}
+	types := params.Get("type")
+	if types == "" {
+		types = "track"
+	}
+	for _, t := range strings.Split(types, ",") {
+		t = strings.TrimSpace(t)
+		if !contains(spotify.SearchTypes, t) {
+			return q, fmt.Errorf("unknown type %q, expected %s", t, strings.Join(spotify.SearchTypes, ", "))
+		}
+		if !contains(q.Types, t) {
+			q.Types = append(q.Types, t)
+		}
+	}
+	var err error
+	if q.Limit, err = QueryInt(params, "limit", limit, 1, spotify.MaxSearchLimit); err != nil {
+		return q, err
+	}
+	if q.Offset, err = QueryInt(params, "offset", 0, 0, spotify.MaxSearchOffset-q.Limit); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// NewSearchResponse : normalize a Spotify search result into one page of every
+// requested type, with links to the neighbouring pages on our api
+func NewSearchResponse(apiURL string, q spotify.SearchQuery, res *spotify.SearchResult) SearchResponse {
+	s := SearchResponse{
+		Query:  q.Q,
+		Types:  q.Types,
+		Market: q.Market,
+		Limit:  q.Limit,
+		Offset: q.Offset,
+	}
+	total := 0
+	page := func(p spotify.Paging, items interface{}) *SearchPage {
+		if p.Total > total {
+			total = p.Total
+		}
+		return &SearchPage{Total: p.Total, Items: items}
+	}
+	if res.Tracks != nil {
+		s.Tracks = page(res.Tracks.Paging, res.Tracks.Items)
+	}
+	if res.Artists != nil {
+		s.Artists = page(res.Artists.Paging, res.Artists.Items)
+	}
+	if res.Albums != nil {
+		s.Albums = page(res.Albums.Paging, res.Albums.Items)
+	}
+	if res.Playlists != nil {
+		s.Playlists = page(res.Playlists.Paging, res.Playlists.Items)
+	}
+	// the page continues while any type has more results
+	if next := q.Offset + q.Limit; next < total && next+q.Limit <= spotify.MaxSearchOffset {
+		s.Next = searchURL(apiURL, q, next)
+	}
+	if q.Offset > 0 {
+		prev := q.Offset - q.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		s.Previous = searchURL(apiURL, q, prev)
+	}
+	return s
+}
+
+// searchURL : our /search url for q starting at offset
+func searchURL(apiURL string, q spotify.SearchQuery, offset int) *string {
+	params := url.Values{}
+	params.Set("q", q.Q)
+	params.Set("type", strings.Join(q.Types, ","))
+	params.Set("limit", strconv.Itoa(q.Limit))
+	params.Set("offset", strconv.Itoa(offset))
+	params.Set("market", q.Market)
+	u := strings.TrimRight(apiURL, "/") + "/search?" + params.Encode()
+	return &u
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// NewServer : http.Server for app with the configured timeouts
+func NewServer(c config, app http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              c.ListenAddr,
+		Handler:           app,
+		ReadHeaderTimeout: c.ReadTimeout.Duration,
+		ReadTimeout:       c.ReadTimeout.Duration,
+		WriteTimeout:      c.WriteTimeout.Duration,
+		IdleTimeout:       c.IdleTimeout.Duration,
+	}
+}
+
+// NewRedirectServer : plain http server sending every request to the https listener
+func NewRedirectServer(c config, t *TLS) *http.Server {
+	_, tlsPort, _ := net.SplitHostPort(c.ListenAddr)
+	return &http.Server{
+		Addr:              c.RedirectAddr,
+		ReadHeaderTimeout: c.ReadTimeout.Duration,
+		ReadTimeout:       c.ReadTimeout.Duration,
+		WriteTimeout:      c.WriteTimeout.Duration,
+		IdleTimeout:       c.IdleTimeout.Duration,
+		Handler: t.HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if tlsPort != "" && tlsPort != "443" {
+				host = net.JoinHostPort(host, tlsPort)
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		})),
+	}
+}
+
+// NewMetricsServer : plain http server exposing /metrics on the internal address
+func NewMetricsServer(c config) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	return &http.Server{
+		Addr:              c.MetricsAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: c.ReadTimeout.Duration,
+		ReadTimeout:       c.ReadTimeout.Duration,
+		WriteTimeout:      c.WriteTimeout.Duration,
+		IdleTimeout:       c.IdleTimeout.Duration,
+	}
+}
+
+// Serve : run app until SIGINT or SIGTERM, then stop accepting connections and
+// wait up to ShutdownTimeout for in-flight requests to finish. SIGHUP reloads
+// manually provided certificates.
+func Serve(c config, app http.Handler) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := NewServer(c, app)
+	servers := []*http.Server{srv}
+	if c.Production {
+		t, err := NewTLS(c)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = t.Config
+		if c.RedirectAddr != "" {
+			servers = append(servers, NewRedirectServer(c, t))
+		}
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		go func() {
+			for range hup {
+				if err := t.Reload(); err != nil {
+					slog.Error("reloading certificates", "error", err)
+					continue
+				}
+				slog.Info("reloaded certificates")
+			}
+		}()
+	}
+	// metrics are best effort, a metrics listener that fails is logged and
+	// dropped instead of taking the api down with it
+	var metrics *http.Server
+	if c.MetricsAddr != "" {
+		metrics = NewMetricsServer(c)
+		go func() {
+			if err := metrics.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("serving metrics", "addr", c.MetricsAddr, "error", err)
+			}
+		}()
+	}
+	errs := make(chan error, len(servers))
+	for i, s := range servers {
+		s := s
+		tls := c.Production && i == 0
+		go func() {
+			var err error
+			if tls {
+				err = s.ListenAndServeTLS("", "")
+			} else {
+				err = s.ListenAndServe()
+			}
+			errs <- err
+		}()
+	}
+	slog.Info("listening", "addr", c.ListenAddr, "production", c.Production, "metrics", c.MetricsAddr)
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		slog.Info("shutting down", "timeout", c.ShutdownTimeout.Duration)
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout.Duration)
+	defer cancel()
+	for _, s := range servers {
+		if shutdownErr := s.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	if metrics != nil {
+		metrics.Shutdown(shutdownCtx)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
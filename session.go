@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/getmicah/myapp-api/spotify"
+)
+
+const (
+	// SessionLifetime : how long a session lives without being refreshed
+	SessionLifetime = 365 * 24 * time.Hour
+	// sessionSweepInterval : how often in-process stores drop expired sessions
+	sessionSweepInterval = 10 * time.Minute
+)
+
+// ErrSessionNotFound : session id is unknown, expired or revoked
+var ErrSessionNotFound = errors.New("Session not found")
+
+// Session : server-side state for a logged in user
+type Session struct {
+	Token  Token        `json:"token"`
+	Expiry time.Time    `json:"expiry"`
+	Scopes []string     `json:"scopes"`
+	User   spotify.User `json:"user"`
+}
+
+// SessionStore : persistence for sessions keyed by an opaque session id
+type SessionStore interface {
+	// Get : load a session, ErrSessionNotFound if it does not exist
+	Get(ctx context.Context, id string) (*Session, error)
+	// Save : create or replace a session that expires after ttl
+	Save(ctx context.Context, id string, s *Session, ttl time.Duration) error
+	// Delete : revoke a session
+	Delete(ctx context.Context, id string) error
+}
+
+// NewSessionStore : create the session store selected in config
+func NewSessionStore(c config) (SessionStore, error) {
+	switch c.SessionStore {
+	case "", "memory":
+		return NewMemorySessionStore(), nil
+	case "bolt":
+		return NewBoltSessionStore(c.SessionPath)
+	case "redis":
+		return NewRedisSessionStore(c.RedisURL)
+	}
+	return nil, fmt.Errorf("unknown session store %q", c.SessionStore)
+}
+
+// NewSessionID : create a random opaque session id
+func NewSessionID() string {
+	return GenerateRandomString(32)
+}
+
+// StartSession : store a freshly issued token and hand the session id to the browser
+func StartSession(w http.ResponseWriter, r *http.Request, store SessionStore, sessionCookie CookieID, token *Token, user *spotify.User) error {
+	id := NewSessionID()
+	s := &Session{
+		Token:  *token,
+		Expiry: time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+		Scopes: strings.Fields(token.Scope),
+		User:   *user,
+	}
+	if err := store.Save(r.Context(), id, s, SessionLifetime); err != nil {
+		return err
+	}
+	return WriteCookie(w, sessionCookie, id, time.Now().Add(SessionLifetime))
+}
+
+// EndSession : revoke the request's session server-side
+func EndSession(r *http.Request, store SessionStore, sessionCookie CookieID) error {
+	id, err := ReadCookie(r, sessionCookie)
+	if err != nil {
+		return nil
+	}
+	return store.Delete(r.Context(), id)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var sessionBucket = []byte("sessions")
+
+// BoltSessionStore : session store persisted to a local bbolt file
+type BoltSessionStore struct {
+	db        *bolt.DB
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+type boltSession struct {
+	Session Session   `json:"session"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewBoltSessionStore : open (or create) the session database at path
+func NewBoltSessionStore(path string) (*BoltSessionStore, error) {
+	if path == "" {
+		return nil, errors.New("sessionPath is required for the bolt session store")
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(sessionBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltSessionStore{db: db, lastSweep: time.Now()}, nil
+}
+
+// Get : implement SessionStore
+func (b *BoltSessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	var bs boltSession
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(sessionBucket).Get([]byte(id))
+		if v == nil {
+			return ErrSessionNotFound
+		}
+		return json.Unmarshal(v, &bs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(bs.Expires) {
+		b.Delete(ctx, id)
+		return nil, ErrSessionNotFound
+	}
+	return &bs.Session, nil
+}
+
+// Save : implement SessionStore
+func (b *BoltSessionStore) Save(ctx context.Context, id string, s *Session, ttl time.Duration) error {
+	now := time.Now()
+	v, err := json.Marshal(boltSession{Session: *s, Expires: now.Add(ttl)})
+	if err != nil {
+		return err
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionBucket).Put([]byte(id), v)
+	})
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	sweep := now.Sub(b.lastSweep) > sessionSweepInterval
+	if sweep {
+		b.lastSweep = now
+	}
+	b.mu.Unlock()
+	if sweep {
+		return b.sweep(now)
+	}
+	return nil
+}
+
+// Delete : implement SessionStore
+func (b *BoltSessionStore) Delete(ctx context.Context, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionBucket).Delete([]byte(id))
+	})
+}
+
+// Close : close the underlying database
+func (b *BoltSessionStore) Close() error {
+	return b.db.Close()
+}
+
+// sweep : drop sessions that expired before now
+func (b *BoltSessionStore) sweep(now time.Time) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(sessionBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var bs boltSession
+			if err := json.Unmarshal(v, &bs); err != nil || now.After(bs.Expires) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemorySessionStore : in-process session store, sessions are lost on restart
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	session Session
+	expires time.Time
+}
+
+// NewMemorySessionStore : create an empty in-memory store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions:  make(map[string]memorySession),
+		lastSweep: time.Now(),
+	}
+}
+
+// Get : implement SessionStore
+func (m *MemorySessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ms, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if time.Now().After(ms.expires) {
+		delete(m.sessions, id)
+		return nil, ErrSessionNotFound
+	}
+	s := ms.session
+	return &s, nil
+}
+
+// Save : implement SessionStore
+func (m *MemorySessionStore) Save(ctx context.Context, id string, s *Session, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.sessions[id] = memorySession{session: *s, expires: now.Add(ttl)}
+	if now.Sub(m.lastSweep) > sessionSweepInterval {
+		for k, v := range m.sessions {
+			if now.After(v.expires) {
+				delete(m.sessions, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	return nil
+}
+
+// Delete : implement SessionStore
+func (m *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
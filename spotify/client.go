@@ -0,0 +1,325 @@
+// Package spotify : typed client for the Spotify Web API
+package spotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBaseURL : Spotify Web API root
+	DefaultBaseURL = "https://api.spotify.com/v1"
+	// DefaultTimeout : timeout for the default http.Client
+	DefaultTimeout = time.Second * 10
+	// MarketFromToken : market asking Spotify to use the country of the access token's user
+	MarketFromToken = "from_token"
+	// MaxTracksPerRequest : most track uris one playlist modification accepts
+	MaxTracksPerRequest = 100
+	// MaxPlaylistTracks : most tracks a playlist can hold
+	MaxPlaylistTracks = 10000
+)
+
+// Client : Spotify Web API client shared by every request
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// New : create a client for the Web API at baseURL using httpClient
+func New(baseURL string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{
+			Timeout:   DefaultTimeout,
+			Transport: &Transport{Policy: DefaultRetryPolicy},
+		}
+	}
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    httpClient,
+	}
+}
+
+// search bounds enforced by Spotify
+const (
+	// MaxSearchLimit : most results per type in one search page
+	MaxSearchLimit = 50
+	// MaxSearchOffset : offset plus limit may not go past this
+	MaxSearchOffset = 1000
+)
+
+// SearchTypes : item types that can be searched for
+var SearchTypes = []string{"track", "artist", "album", "playlist"}
+
+// SearchQuery : parameters for Search
+type SearchQuery struct {
+	Q      string
+	Types  []string
+	Limit  int
+	Offset int
+	Market string
+}
+
+// Search : search the Spotify catalog
+func (c *Client) Search(ctx context.Context, accessToken string, q SearchQuery) (*SearchResult, error) {
+	params := url.Values{}
+	params.Set("q", q.Q)
+	params.Set("type", strings.Join(q.Types, ","))
+	if q.Limit > 0 {
+		params.Set("limit", fmt.Sprint(q.Limit))
+	}
+	if q.Offset > 0 {
+		params.Set("offset", fmt.Sprint(q.Offset))
+	}
+	if q.Market != "" {
+		params.Set("market", q.Market)
+	}
+	var res SearchResult
+	if err := c.get(ctx, accessToken, "/search?"+params.Encode(), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GetArtist : get a single artist by id
+func (c *Client) GetArtist(ctx context.Context, accessToken string, id string) (*Artist, error) {
+	var res Artist
+	if err := c.get(ctx, accessToken, "/artists/"+url.PathEscape(id), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GetArtistTopTracks : get an artist's most popular tracks in market
+func (c *Client) GetArtistTopTracks(ctx context.Context, accessToken string, id string, market string) ([]Track, error) {
+	var res struct {
+		Tracks []Track `json:"tracks"`
+	}
+	endpoint := "/artists/" + url.PathEscape(id) + "/top-tracks?market=" + url.QueryEscape(market)
+	if err := c.get(ctx, accessToken, endpoint, &res); err != nil {
+		return nil, err
+	}
+	return res.Tracks, nil
+}
+
+// GetTrack : get a single track by id, relinked for market when it is set
+func (c *Client) GetTrack(ctx context.Context, accessToken string, id string, market string) (*Track, error) {
+	var res Track
+	endpoint := "/tracks/" + url.PathEscape(id)
+	if market != "" {
+		endpoint += "?market=" + url.QueryEscape(market)
+	}
+	if err := c.get(ctx, accessToken, endpoint, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GetRecommendations : get track recommendations for the given seeds and tunables
+func (c *Client) GetRecommendations(ctx context.Context, accessToken string, q RecommendationsQuery) (*Recommendations, error) {
+	var res Recommendations
+	if err := c.get(ctx, accessToken, "/recommendations?"+q.Values().Encode(), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// AvailableGenreSeeds : get the genres recommendations can be seeded with
+func (c *Client) AvailableGenreSeeds(ctx context.Context, accessToken string) ([]string, error) {
+	var res struct {
+		Genres []string `json:"genres"`
+	}
+	if err := c.get(ctx, accessToken, "/recommendations/available-genre-seeds", &res); err != nil {
+		return nil, err
+	}
+	return res.Genres, nil
+}
+
+// Me : get the current user's profile
+func (c *Client) Me(ctx context.Context, accessToken string) (*User, error) {
+	var res User
+	if err := c.get(ctx, accessToken, "/me", &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// CreatePlaylist : create a playlist owned by userID
+func (c *Client) CreatePlaylist(ctx context.Context, accessToken string, userID string, p NewPlaylist) (*Playlist, error) {
+	var res Playlist
+	endpoint := fmt.Sprintf("/users/%s/playlists", url.PathEscape(userID))
+	if err := c.send(ctx, accessToken, http.MethodPost, endpoint, p, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GetPlaylist : get a playlist, limited to fields (Spotify's field filter) when set
+func (c *Client) GetPlaylist(ctx context.Context, accessToken string, playlistID string, fields string) (*Playlist, error) {
+	var res Playlist
+	endpoint := "/playlists/" + url.PathEscape(playlistID)
+	if fields != "" {
+		endpoint += "?fields=" + url.QueryEscape(fields)
+	}
+	if err := c.get(ctx, accessToken, endpoint, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// AddTracks : append track uris to a playlist and return the new snapshot id
+func (c *Client) AddTracks(ctx context.Context, accessToken string, playlistID string, uris []string) (string, error) {
+	var res Snapshot
+	endpoint := fmt.Sprintf("/playlists/%s/tracks", url.PathEscape(playlistID))
+	body := struct {
+		URIs []string `json:"uris"`
+	}{uris}
+	if err := c.send(ctx, accessToken, http.MethodPost, endpoint, body, &res); err != nil {
+		return "", err
+	}
+	return res.SnapshotID, nil
+}
+
+// InsertTracks : insert track uris into a playlist before position and return the new snapshot id
+func (c *Client) InsertTracks(ctx context.Context, accessToken string, playlistID string, uris []string, position int) (string, error) {
+	var res Snapshot
+	endpoint := fmt.Sprintf("/playlists/%s/tracks", url.PathEscape(playlistID))
+	body := struct {
+		URIs     []string `json:"uris"`
+		Position int      `json:"position"`
+	}{uris, position}
+	if err := c.send(ctx, accessToken, http.MethodPost, endpoint, body, &res); err != nil {
+		return "", err
+	}
+	return res.SnapshotID, nil
+}
+
+// ReplaceTracks : replace every track of a playlist with uris and return the new snapshot id
+func (c *Client) ReplaceTracks(ctx context.Context, accessToken string, playlistID string, uris []string) (string, error) {
+	var res Snapshot
+	endpoint := fmt.Sprintf("/playlists/%s/tracks", url.PathEscape(playlistID))
+	// without a uris list Spotify reads the PUT as a reorder
+	if uris == nil {
+		uris = []string{}
+	}
+	body := struct {
+		URIs []string `json:"uris"`
+	}{uris}
+	if err := c.send(ctx, accessToken, http.MethodPut, endpoint, body, &res); err != nil {
+		return "", err
+	}
+	return res.SnapshotID, nil
+}
+
+// GetPlaylistItems : get limit (at most 100) entries of a playlist from offset
+func (c *Client) GetPlaylistItems(ctx context.Context, accessToken string, playlistID string, offset int, limit int) (*PlaylistItemPage, error) {
+	var res PlaylistItemPage
+	params := url.Values{}
+	params.Set("offset", fmt.Sprint(offset))
+	params.Set("limit", fmt.Sprint(limit))
+	params.Set("fields", "offset,limit,total,items(track(uri))")
+	endpoint := fmt.Sprintf("/playlists/%s/tracks?%s", url.PathEscape(playlistID), params.Encode())
+	if err := c.get(ctx, accessToken, endpoint, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// RemoveTracks : remove tracks from a playlist, positions are resolved against
+// snapshotID when it is set. Returns the new snapshot id.
+func (c *Client) RemoveTracks(ctx context.Context, accessToken string, playlistID string, tracks []TrackRef, snapshotID string) (string, error) {
+	var res Snapshot
+	endpoint := fmt.Sprintf("/playlists/%s/tracks", url.PathEscape(playlistID))
+	body := struct {
+		Tracks     []TrackRef `json:"tracks"`
+		SnapshotID string     `json:"snapshot_id,omitempty"`
+	}{tracks, snapshotID}
+	// positions of a repeated request would point at other tracks
+	for _, t := range tracks {
+		if len(t.Positions) > 0 {
+			ctx = sendOnce(ctx)
+			break
+		}
+	}
+	if err := c.send(ctx, accessToken, http.MethodDelete, endpoint, body, &res); err != nil {
+		return "", err
+	}
+	return res.SnapshotID, nil
+}
+
+// ReorderTracks : move a range of a playlist's tracks and return the new snapshot id
+func (c *Client) ReorderTracks(ctx context.Context, accessToken string, playlistID string, r Reorder) (string, error) {
+	var res Snapshot
+	endpoint := fmt.Sprintf("/playlists/%s/tracks", url.PathEscape(playlistID))
+	// a repeated move would move another range
+	if err := c.send(sendOnce(ctx), accessToken, http.MethodPut, endpoint, r, &res); err != nil {
+		return "", err
+	}
+	return res.SnapshotID, nil
+}
+
+// UnfollowPlaylist : remove a playlist from the user's library, which is how
+// Spotify deletes playlists
+func (c *Client) UnfollowPlaylist(ctx context.Context, accessToken string, playlistID string) error {
+	endpoint := fmt.Sprintf("/playlists/%s/followers", url.PathEscape(playlistID))
+	return c.send(ctx, accessToken, http.MethodDelete, endpoint, nil, nil)
+}
+
+// UploadPlaylistImage : replace a playlist's cover with a base64 encoded JPEG
+func (c *Client) UploadPlaylistImage(ctx context.Context, accessToken string, playlistID string, jpeg string) error {
+	endpoint := fmt.Sprintf("/playlists/%s/images", url.PathEscape(playlistID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.baseURL+endpoint, strings.NewReader(jpeg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "image/jpeg")
+	return c.do(req, accessToken, nil)
+}
+
+func (c *Client) get(ctx context.Context, accessToken string, endpoint string, dst interface{}) error {
+	return c.send(ctx, accessToken, http.MethodGet, endpoint, nil, dst)
+}
+
+func (c *Client) send(ctx context.Context, accessToken string, method string, endpoint string, body interface{}, dst interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		buf := new(bytes.Buffer)
+		if err := json.NewEncoder(buf).Encode(body); err != nil {
+			return err
+		}
+		reader = buf
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.do(req, accessToken, dst)
+}
+
+func (c *Client) do(req *http.Request, accessToken string, dst interface{}) error {
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return ErrorFromResponse(res)
+	}
+	if dst == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(dst)
+}
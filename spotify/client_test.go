@@ -0,0 +1,103 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReplaceTracksAlwaysSendsURIs(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		if r.Method != http.MethodPut || r.URL.Path != "/v1/playlists/pl/tracks" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		io.WriteString(w, `{"snapshot_id":"snap"}`)
+	}))
+	defer srv.Close()
+	c := New(srv.URL+"/v1", srv.Client())
+	for _, uris := range [][]string{nil, {}} {
+		if _, err := c.ReplaceTracks(context.Background(), "tok", "pl", uris); err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(body) != `{"uris":[]}` {
+			t.Errorf("ReplaceTracks(%#v) sent %s, want an empty uris list", uris, body)
+		}
+	}
+}
+
+func TestTrackMovesAreNotResent(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	c := New(srv.URL+"/v1", nil)
+	ctx := context.Background()
+	calls := map[string]func() error{
+		"ReorderTracks": func() error {
+			_, err := c.ReorderTracks(ctx, "tok", "pl", Reorder{RangeStart: 0, InsertBefore: 2, RangeLength: 1})
+			return err
+		},
+		"RemoveTracks at positions": func() error {
+			_, err := c.RemoveTracks(ctx, "tok", "pl", []TrackRef{{URI: "spotify:track:a", Positions: []int{3}}}, "snap")
+			return err
+		},
+	}
+	for name, call := range calls {
+		attempts = 0
+		if err := call(); err == nil {
+			t.Errorf("%s: got no error for a 502", name)
+		}
+		if attempts != 1 {
+			t.Errorf("%s: sent %d times, want 1", name, attempts)
+		}
+	}
+}
+
+func TestTrackAndArtistKeepSpotifyFields(t *testing.T) {
+	bodies := map[string]string{
+		"/v1/tracks/relinked": `{"id":"relinked","name":"Song","uri":"spotify:track:relinked",
+			"href":"https://api.spotify.com/v1/tracks/relinked","type":"track",
+			"artists":[{"id":"a","name":"Artist","uri":"spotify:artist:a","href":"https://api.spotify.com/v1/artists/a","type":"artist","external_urls":{"spotify":"https://open.spotify.com/artist/a"}}],
+			"album":{"id":"al","name":"Album","uri":"spotify:album:al","href":"https://api.spotify.com/v1/albums/al","type":"album",
+				"album_type":"album","total_tracks":9,"release_date":"1997","release_date_precision":"year",
+				"images":[{"url":"https://i.scdn.co/image/x","height":640,"width":640}],"artists":[],"external_urls":{"spotify":"https://open.spotify.com/album/al"}},
+			"disc_number":1,"track_number":3,"duration_ms":200000,"explicit":false,"is_local":false,"popularity":70,
+			"preview_url":"https://p.scdn.co/mp3-preview/x","is_playable":true,
+			"linked_from":{"id":"asked","uri":"spotify:track:asked","href":"https://api.spotify.com/v1/tracks/asked","type":"track","external_urls":{"spotify":"https://open.spotify.com/track/asked"}},
+			"external_ids":{"isrc":"GBAYE9700001"},"external_urls":{"spotify":"https://open.spotify.com/track/relinked"}}`,
+		"/v1/artists/a": `{"id":"a","name":"Artist","uri":"spotify:artist:a","href":"https://api.spotify.com/v1/artists/a","type":"artist",
+			"genres":["rock"],"images":[],"popularity":80,"followers":{"total":5},"external_urls":{"spotify":"https://open.spotify.com/artist/a"}}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, bodies[r.URL.Path])
+	}))
+	defer srv.Close()
+	c := New(srv.URL+"/v1", nil)
+	track, err := c.GetTrack(context.Background(), "tok", "relinked", "SE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	artist, err := c.GetArtist(context.Background(), "tok", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, v := range map[string]interface{}{"/v1/tracks/relinked": track, "/v1/artists/a": artist} {
+		var want, got interface{}
+		json.Unmarshal([]byte(bodies[path]), &want)
+		b, _ := json.Marshal(v)
+		json.Unmarshal(b, &got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: re-encoded as %s", path, b)
+		}
+	}
+}
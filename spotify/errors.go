@@ -0,0 +1,92 @@
+package spotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxErrorBody : most of a failed response's body kept on Error
+const maxErrorBody = 64 << 10
+
+// Error : non-2xx response from Spotify
+type Error struct {
+	Status int
+	// Message : Spotify's explanation of the failure, the status line if it sent none
+	Message string
+	// Reason : OAuth error code sent by the accounts service, e.g. invalid_grant
+	Reason string
+	// RetryAfter : how long Spotify asked us to wait, set on 429 responses
+	RetryAfter time.Duration
+	// Body : the response body as sent by Spotify
+	Body []byte
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if e.Reason != "" && e.Reason != e.Message {
+		msg = e.Reason + ": " + msg
+	}
+	if e.Status == http.StatusTooManyRequests {
+		return fmt.Sprintf("%s, retry in %d seconds", msg, e.RetrySeconds())
+	}
+	return msg
+}
+
+// apiError : error body of the Web API, {"error": {"status": 404, "message": "..."}}
+type apiError struct {
+	Error struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// authError : error body of the accounts service, {"error": "...", "error_description": "..."}
+type authError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// parseBody : fill Message and Reason from either of Spotify's error body formats
+func (e *Error) parseBody() {
+	var api apiError
+	if err := json.Unmarshal(e.Body, &api); err == nil && api.Error.Message != "" {
+		e.Message = api.Error.Message
+		return
+	}
+	var auth authError
+	if err := json.Unmarshal(e.Body, &auth); err == nil && auth.Error != "" {
+		e.Reason = auth.Error
+		e.Message = auth.Error
+		if auth.ErrorDescription != "" {
+			e.Message = auth.ErrorDescription
+		}
+	}
+}
+
+// RateLimited : whether Spotify rejected the request for exceeding its rate limit
+func (e *Error) RateLimited() bool {
+	return e.Status == http.StatusTooManyRequests
+}
+
+// RetrySeconds : RetryAfter rounded up to whole seconds
+func (e *Error) RetrySeconds() int {
+	return int((e.RetryAfter + time.Second - 1) / time.Second)
+}
+
+// ErrorFromResponse : build an Error from a failed Spotify response, reading its body
+func ErrorFromResponse(res *http.Response) *Error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	e := &Error{
+		Status:  res.StatusCode,
+		Message: res.Status,
+		Body:    body,
+	}
+	e.parseBody()
+	if wait, ok := RetryAfter(res); ok {
+		e.RetryAfter = wait
+	}
+	return e
+}
@@ -0,0 +1,156 @@
+package spotify
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy : how failed Spotify requests are retried
+type RetryPolicy struct {
+	// MaxRetries : retries after the first attempt, 0 disables retrying
+	MaxRetries int
+	// BaseDelay : backoff before the first retry, doubled on each attempt
+	BaseDelay time.Duration
+	// MaxDelay : upper bound for a single backoff
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy : retry policy used when none is configured
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  250 * time.Millisecond,
+	MaxDelay:   5 * time.Second,
+}
+
+// Transport : http.RoundTripper that retries rate limited, 5xx and failed requests.
+// 429 responses wait for Retry-After; 5xx responses and network errors back off
+// exponentially with jitter and are only retried for idempotent methods not sent
+// with sendOnce. A retry is never started if its wait would outlive the request
+// context deadline; the last response or error is returned instead.
+type Transport struct {
+	Base   http.RoundTripper
+	Policy RetryPolicy
+	// OnRetry : optional hook called before each retry with the failed attempt
+	OnRetry func(req *http.Request, res *http.Response, err error)
+}
+
+// RoundTrip : implement http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 {
+			r = req.Clone(ctx)
+			if req.Body != nil && req.Body != http.NoBody {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				r.Body = body
+			}
+		}
+		res, err := base.RoundTrip(r)
+		wait, retry := t.backoff(req, res, err, attempt)
+		if !retry {
+			return res, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return res, err
+		}
+		if t.OnRetry != nil {
+			t.OnRetry(req, res, err)
+		}
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff : decide whether attempt should be retried and how long to wait first
+func (t *Transport) backoff(req *http.Request, res *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= t.Policy.MaxRetries || req.Context().Err() != nil {
+		return 0, false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return 0, false
+	}
+	if err == nil && res.StatusCode == http.StatusTooManyRequests {
+		if wait, ok := RetryAfter(res); ok {
+			return wait, true
+		}
+		return t.jitter(attempt), true
+	}
+	if !idempotent(req.Method) || req.Context().Value(onceKey{}) != nil {
+		return 0, false
+	}
+	if err != nil || res.StatusCode >= 500 {
+		return t.jitter(attempt), true
+	}
+	return 0, false
+}
+
+// onceKey : context key marking a request sent with sendOnce
+type onceKey struct{}
+
+// sendOnce : ctx for a request that must not be repeated after a 5xx or network
+// error although its method is idempotent, e.g. a PUT moving tracks. Rate limited
+// attempts were not applied and are still retried.
+func sendOnce(ctx context.Context) context.Context {
+	return context.WithValue(ctx, onceKey{}, true)
+}
+
+// jitter : exponential backoff for attempt with random jitter in [d/2, d]
+func (t *Transport) jitter(attempt int) time.Duration {
+	d := t.Policy.BaseDelay << uint(attempt)
+	if d <= 0 || (t.Policy.MaxDelay > 0 && d > t.Policy.MaxDelay) {
+		d = t.Policy.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// RetryAfter : parse the Retry-After header of a response
+func RetryAfter(res *http.Response) (time.Duration, bool) {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		wait := time.Until(at)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
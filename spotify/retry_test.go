@@ -0,0 +1,248 @@
+package spotify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fastPolicy : retry policy with backoffs short enough for tests
+var fastPolicy = RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+
+// attemptServer : test server answering attempt n with statuses[n], the last status
+// repeating, and recording the body of every attempt
+type attemptServer struct {
+	*httptest.Server
+	mu         sync.Mutex
+	bodies     []string
+	statuses   []int
+	retryAfter string
+}
+
+func newAttemptServer(t *testing.T, retryAfter string, statuses ...int) *attemptServer {
+	s := &attemptServer{statuses: statuses, retryAfter: retryAfter}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		n := len(s.bodies)
+		s.bodies = append(s.bodies, string(body))
+		s.mu.Unlock()
+		status := s.statuses[min(n, len(s.statuses)-1)]
+		if status == http.StatusTooManyRequests && s.retryAfter != "" {
+			w.Header().Set("Retry-After", s.retryAfter)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, `{}`)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *attemptServer) attempts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+func doRequest(t *testing.T, tr *Transport, ctx context.Context, method string, url string, body string) (*http.Response, error) {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tr.RoundTrip(req)
+	if err == nil {
+		t.Cleanup(func() { res.Body.Close() })
+	}
+	return res, err
+}
+
+func TestRetryAfter(t *testing.T) {
+	future := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		header string
+		min    time.Duration
+		max    time.Duration
+		ok     bool
+	}{
+		{"", 0, 0, false},
+		{"3", 3 * time.Second, 3 * time.Second, true},
+		{"0", 0, 0, true},
+		{"-1", 0, 0, false},
+		{"soon", 0, 0, false},
+		{future, 80 * time.Second, 90 * time.Second, true},
+		{past, 0, 0, true},
+	}
+	for _, tt := range tests {
+		res := &http.Response{Header: http.Header{}}
+		if tt.header != "" {
+			res.Header.Set("Retry-After", tt.header)
+		}
+		wait, ok := RetryAfter(res)
+		if ok != tt.ok || wait < tt.min || wait > tt.max {
+			t.Errorf("RetryAfter(%q) = %v, %v, want %v..%v, %v", tt.header, wait, ok, tt.min, tt.max, tt.ok)
+		}
+	}
+}
+
+func TestTransportRetriesRateLimited(t *testing.T) {
+	srv := newAttemptServer(t, "0", http.StatusTooManyRequests, http.StatusOK)
+	retries := 0
+	tr := &Transport{Policy: fastPolicy, OnRetry: func(*http.Request, *http.Response, error) { retries++ }}
+	res, err := doRequest(t, tr, context.Background(), http.MethodGet, srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || len(srv.attempts()) != 2 || retries != 1 {
+		t.Errorf("got status %d after %d attempts and %d retries, want 200 after 2 and 1", res.StatusCode, len(srv.attempts()), retries)
+	}
+}
+
+func TestTransportRetriesServerErrorsForIdempotentMethods(t *testing.T) {
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		srv := newAttemptServer(t, "", http.StatusServiceUnavailable, http.StatusOK)
+		res, err := doRequest(t, &Transport{Policy: fastPolicy}, context.Background(), method, srv.URL, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK || len(srv.attempts()) != 2 {
+			t.Errorf("%s: got status %d after %d attempts, want 200 after 2", method, res.StatusCode, len(srv.attempts()))
+		}
+	}
+}
+
+func TestTransportDoesNotRetryServerErrorsForPost(t *testing.T) {
+	srv := newAttemptServer(t, "", http.StatusBadGateway, http.StatusOK)
+	res, err := doRequest(t, &Transport{Policy: fastPolicy}, context.Background(), http.MethodPost, srv.URL, `{"a":1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusBadGateway || len(srv.attempts()) != 1 {
+		t.Errorf("got status %d after %d attempts, want 502 after 1", res.StatusCode, len(srv.attempts()))
+	}
+}
+
+func TestTransportReplaysBodyOnRetry(t *testing.T) {
+	srv := newAttemptServer(t, "0", http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusCreated)
+	res, err := doRequest(t, &Transport{Policy: fastPolicy}, context.Background(), http.MethodPost, srv.URL, `{"uris":["x"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("got status %d, want 201", res.StatusCode)
+	}
+	attempts := srv.attempts()
+	if len(attempts) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(attempts))
+	}
+	for i, body := range attempts {
+		if body != `{"uris":["x"]}` {
+			t.Errorf("attempt %d sent body %q", i, body)
+		}
+	}
+}
+
+func TestTransportDoesNotRetryWithoutGetBody(t *testing.T) {
+	srv := newAttemptServer(t, "0", http.StatusTooManyRequests, http.StatusOK)
+	req, err := http.NewRequest(http.MethodPut, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Body = io.NopCloser(strings.NewReader("once"))
+	res, err := (&Transport{Policy: fastPolicy}).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusTooManyRequests || len(srv.attempts()) != 1 {
+		t.Errorf("got status %d after %d attempts, want 429 after 1", res.StatusCode, len(srv.attempts()))
+	}
+}
+
+func TestTransportSkipsRetryPastDeadline(t *testing.T) {
+	srv := newAttemptServer(t, "30", http.StatusTooManyRequests, http.StatusOK)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	res, err := doRequest(t, &Transport{Policy: fastPolicy}, ctx, http.MethodGet, srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("waited %v for a retry that could not finish in time", elapsed)
+	}
+	if res.StatusCode != http.StatusTooManyRequests || len(srv.attempts()) != 1 {
+		t.Errorf("got status %d after %d attempts, want 429 after 1", res.StatusCode, len(srv.attempts()))
+	}
+}
+
+func TestTransportStopsAfterMaxRetries(t *testing.T) {
+	srv := newAttemptServer(t, "", http.StatusInternalServerError)
+	policy := fastPolicy
+	policy.MaxRetries = 2
+	res, err := doRequest(t, &Transport{Policy: policy}, context.Background(), http.MethodGet, srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusInternalServerError || len(srv.attempts()) != 3 {
+		t.Errorf("got status %d after %d attempts, want 500 after 3", res.StatusCode, len(srv.attempts()))
+	}
+}
+
+func TestClientRetriesAgainstBaseURL(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+		if r.URL.Path != "/v1/me" || r.Header.Get("Authorization") != "Bearer tok" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		if n == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, `{"id":"tester","country":"SE"}`)
+	}))
+	defer srv.Close()
+	user, err := New(srv.URL+"/v1", nil).Me(context.Background(), "tok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "tester" || calls != 2 {
+		t.Errorf("got user %q after %d calls, want tester after 2", user.ID, calls)
+	}
+}
+
+func TestTransportSendOnce(t *testing.T) {
+	tests := []struct {
+		status   int
+		attempts int
+	}{
+		{http.StatusBadGateway, 1},
+		{http.StatusTooManyRequests, 2},
+	}
+	for _, tt := range tests {
+		srv := newAttemptServer(t, "0", tt.status, http.StatusOK)
+		res, err := doRequest(t, &Transport{Policy: fastPolicy}, sendOnce(context.Background()), http.MethodPut, srv.URL, `{"range_start":0}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(srv.attempts()); n != tt.attempts {
+			t.Errorf("status %d: got %d attempts (last %d), want %d", tt.status, n, res.StatusCode, tt.attempts)
+		}
+	}
+}
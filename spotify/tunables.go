@@ -0,0 +1,89 @@
+package spotify
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxSeeds : most seed artists, tracks and genres combined per recommendation request
+	MaxSeeds = 5
+	// MaxRecommendationsLimit : most tracks one recommendation request returns
+	MaxRecommendationsLimit = 100
+)
+
+// Tunable : bounds of a track attribute recommendations can be tuned with
+type Tunable struct {
+	Min float64
+	Max float64
+	// Integer : the attribute only takes whole numbers
+	Integer bool
+}
+
+// Tunables : attributes accepted as min_, max_ and target_ recommendation parameters
+var Tunables = map[string]Tunable{
+	"acousticness":     {Min: 0, Max: 1},
+	"danceability":     {Min: 0, Max: 1},
+	"duration_ms":      {Min: 0, Max: 3600000, Integer: true},
+	"energy":           {Min: 0, Max: 1},
+	"instrumentalness": {Min: 0, Max: 1},
+	"key":              {Min: 0, Max: 11, Integer: true},
+	"liveness":         {Min: 0, Max: 1},
+	"loudness":         {Min: -60, Max: 0},
+	"mode":             {Min: 0, Max: 1, Integer: true},
+	"popularity":       {Min: 0, Max: 100, Integer: true},
+	"speechiness":      {Min: 0, Max: 1},
+	"tempo":            {Min: 0, Max: 300},
+	"time_signature":   {Min: 3, Max: 7, Integer: true},
+	"valence":          {Min: 0, Max: 1},
+}
+
+// TunablePrefixes : prefixes a tunable attribute is sent with
+var TunablePrefixes = []string{"min_", "max_", "target_"}
+
+// RecommendationsQuery : parameters for GetRecommendations
+type RecommendationsQuery struct {
+	SeedArtists []string
+	SeedTracks  []string
+	SeedGenres  []string
+	Limit       int
+	Market      string
+	// Tunables : values keyed by prefixed attribute, e.g. min_energy
+	Tunables map[string]float64
+}
+
+// Seeds : number of seeds combined
+func (q RecommendationsQuery) Seeds() int {
+	return len(q.SeedArtists) + len(q.SeedTracks) + len(q.SeedGenres)
+}
+
+// Values : query string for the /recommendations endpoint
+func (q RecommendationsQuery) Values() url.Values {
+	params := url.Values{}
+	if len(q.SeedArtists) > 0 {
+		params.Set("seed_artists", strings.Join(q.SeedArtists, ","))
+	}
+	if len(q.SeedTracks) > 0 {
+		params.Set("seed_tracks", strings.Join(q.SeedTracks, ","))
+	}
+	if len(q.SeedGenres) > 0 {
+		params.Set("seed_genres", strings.Join(q.SeedGenres, ","))
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Market != "" {
+		params.Set("market", q.Market)
+	}
+	names := make([]string, 0, len(q.Tunables))
+	for name := range q.Tunables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		params.Set(name, strconv.FormatFloat(q.Tunables[name], 'f', -1, 64))
+	}
+	return params
+}
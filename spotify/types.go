@@ -0,0 +1,214 @@
+package spotify
+
+// Image : album, artist or playlist artwork
+type Image struct {
+	URL    string `json:"url"`
+	Height int    `json:"height"`
+	Width  int    `json:"width"`
+}
+
+// Followers : follower count of an artist, playlist or user
+type Followers struct {
+	Total int `json:"total"`
+}
+
+// User : spotify user profile
+type User struct {
+	ID           string            `json:"id"`
+	DisplayName  string            `json:"display_name"`
+	Country      string            `json:"country,omitempty"`
+	URI          string            `json:"uri"`
+	ExternalURLs map[string]string `json:"external_urls"`
+}
+
+// SimpleArtist : artist as embedded in tracks and albums
+type SimpleArtist struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	URI          string            `json:"uri"`
+	Href         string            `json:"href"`
+	Type         string            `json:"type"`
+	ExternalURLs map[string]string `json:"external_urls"`
+}
+
+// Artist : full artist object
+type Artist struct {
+	SimpleArtist
+	Genres     []string  `json:"genres"`
+	Images     []Image   `json:"images"`
+	Popularity int       `json:"popularity"`
+	Followers  Followers `json:"followers"`
+}
+
+// SimpleAlbum : album as embedded in tracks
+type SimpleAlbum struct {
+	ID                   string            `json:"id"`
+	Name                 string            `json:"name"`
+	URI                  string            `json:"uri"`
+	Href                 string            `json:"href"`
+	Type                 string            `json:"type"`
+	AlbumType            string            `json:"album_type"`
+	TotalTracks          int               `json:"total_tracks"`
+	ReleaseDate          string            `json:"release_date"`
+	ReleaseDatePrecision string            `json:"release_date_precision"`
+	Images               []Image           `json:"images"`
+	Artists              []SimpleArtist    `json:"artists"`
+	AvailableMarkets     []string          `json:"available_markets,omitempty"`
+	ExternalURLs         map[string]string `json:"external_urls"`
+}
+
+// TrackLink : the track originally asked for when Spotify relinked it for a market
+type TrackLink struct {
+	ID           string            `json:"id"`
+	URI          string            `json:"uri"`
+	Href         string            `json:"href"`
+	Type         string            `json:"type"`
+	ExternalURLs map[string]string `json:"external_urls"`
+}
+
+// Restrictions : why a track or album cannot be played
+type Restrictions struct {
+	Reason string `json:"reason"`
+}
+
+// Track : full track object. IsPlayable, LinkedFrom and Restrictions are only sent
+// when a market was given, AvailableMarkets only when none was.
+type Track struct {
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	URI              string            `json:"uri"`
+	Href             string            `json:"href"`
+	Type             string            `json:"type"`
+	Artists          []SimpleArtist    `json:"artists"`
+	Album            SimpleAlbum       `json:"album"`
+	DiscNumber       int               `json:"disc_number"`
+	TrackNumber      int               `json:"track_number"`
+	DurationMs       int               `json:"duration_ms"`
+	Explicit         bool              `json:"explicit"`
+	IsLocal          bool              `json:"is_local"`
+	Popularity       int               `json:"popularity"`
+	PreviewURL       string            `json:"preview_url"`
+	IsPlayable       *bool             `json:"is_playable,omitempty"`
+	LinkedFrom       *TrackLink        `json:"linked_from,omitempty"`
+	Restrictions     *Restrictions     `json:"restrictions,omitempty"`
+	AvailableMarkets []string          `json:"available_markets,omitempty"`
+	ExternalIDs      map[string]string `json:"external_ids"`
+	ExternalURLs     map[string]string `json:"external_urls"`
+}
+
+// SimplePlaylist : playlist as returned by search
+type SimplePlaylist struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	URI           string            `json:"uri"`
+	Description   string            `json:"description"`
+	Public        bool              `json:"public"`
+	Collaborative bool              `json:"collaborative"`
+	SnapshotID    string            `json:"snapshot_id"`
+	Owner         User              `json:"owner"`
+	Images        []Image           `json:"images"`
+	ExternalURLs  map[string]string `json:"external_urls"`
+}
+
+// Playlist : full playlist object, tracks only holds the paging fields
+type Playlist struct {
+	SimplePlaylist
+	Followers Followers `json:"followers"`
+	Tracks    Paging    `json:"tracks"`
+}
+
+// Paging : common fields of a spotify paging object
+type Paging struct {
+	Href     string `json:"href"`
+	Limit    int    `json:"limit"`
+	Offset   int    `json:"offset"`
+	Total    int    `json:"total"`
+	Next     string `json:"next"`
+	Previous string `json:"previous"`
+}
+
+// TrackPage : page of tracks
+type TrackPage struct {
+	Paging
+	Items []Track `json:"items"`
+}
+
+// ArtistPage : page of artists
+type ArtistPage struct {
+	Paging
+	Items []Artist `json:"items"`
+}
+
+// AlbumPage : page of albums
+type AlbumPage struct {
+	Paging
+	Items []SimpleAlbum `json:"items"`
+}
+
+// PlaylistPage : page of playlists
+type PlaylistPage struct {
+	Paging
+	Items []SimplePlaylist `json:"items"`
+}
+
+// SearchResult : /search response, one page per requested type
+type SearchResult struct {
+	Tracks    *TrackPage    `json:"tracks,omitempty"`
+	Artists   *ArtistPage   `json:"artists,omitempty"`
+	Albums    *AlbumPage    `json:"albums,omitempty"`
+	Playlists *PlaylistPage `json:"playlists,omitempty"`
+}
+
+// RecommendationSeed : seed used to generate recommendations
+type RecommendationSeed struct {
+	ID                 string `json:"id"`
+	Type               string `json:"type"`
+	Href               string `json:"href"`
+	InitialPoolSize    int    `json:"initialPoolSize"`
+	AfterFilteringSize int    `json:"afterFilteringSize"`
+	AfterRelinkingSize int    `json:"afterRelinkingSize"`
+}
+
+// Recommendations : /recommendations response
+type Recommendations struct {
+	Seeds  []RecommendationSeed `json:"seeds"`
+	Tracks []Track              `json:"tracks"`
+}
+
+// NewPlaylist : post body for creating a playlist, collaborative playlists must be private
+type NewPlaylist struct {
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	Public        bool   `json:"public"`
+	Collaborative bool   `json:"collaborative"`
+}
+
+// PlaylistItem : track entry of a playlist
+type PlaylistItem struct {
+	Track Track `json:"track"`
+}
+
+// PlaylistItemPage : page of playlist entries
+type PlaylistItemPage struct {
+	Paging
+	Items []PlaylistItem `json:"items"`
+}
+
+// TrackRef : track to remove from a playlist, only at positions when set
+type TrackRef struct {
+	URI       string `json:"uri"`
+	Positions []int  `json:"positions,omitempty"`
+}
+
+// Reorder : move range_length tracks starting at range_start to before insert_before
+type Reorder struct {
+	RangeStart   int    `json:"range_start"`
+	InsertBefore int    `json:"insert_before"`
+	RangeLength  int    `json:"range_length"`
+	SnapshotID   string `json:"snapshot_id,omitempty"`
+}
+
+// Snapshot : playlist snapshot returned by track modifications
+type Snapshot struct {
+	SnapshotID string `json:"snapshot_id"`
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLS : certificate source for the production listener
+type TLS struct {
+	Config   *tls.Config
+	manager  *autocert.Manager
+	reloader *CertReloader
+}
+
+// NewTLS : obtain certificates from the ACME directory when enabled,
+// otherwise serve the tlsCert/tlsKey files
+func NewTLS(c config) (*TLS, error) {
+	if !c.ACME {
+		reloader, err := NewCertReloader(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		return &TLS{
+			Config:   &tls.Config{GetCertificate: reloader.GetCertificate},
+			reloader: reloader,
+		}, nil
+	}
+	hosts := c.ACMEHosts
+	if len(hosts) == 0 {
+		u, err := url.Parse(c.APIURL)
+		if err != nil || u.Hostname() == "" {
+			return nil, errors.New("acmeHosts or apiURL is required for acme")
+		}
+		hosts = []string{u.Hostname()}
+	}
+	client := &acme.Client{DirectoryURL: c.ACMEDirectoryURL}
+	if c.ACMECARoot != "" {
+		pem, err := ioutil.ReadFile(c.ACMECARoot)
+		if err != nil {
+			return nil, err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", c.ACMECARoot)
+		}
+		client.HTTPClient = &http.Client{
+			Timeout: c.ClientTimeout.Duration,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: roots},
+			},
+		}
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(c.ACMECacheDir),
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Email:      c.ACMEEmail,
+		Client:     client,
+	}
+	return &TLS{Config: m.TLSConfig(), manager: m}, nil
+}
+
+// HTTPHandler : answer ACME http-01 challenges on the plain http listener and
+// pass everything else to fallback
+func (t *TLS) HTTPHandler(fallback http.Handler) http.Handler {
+	if t.manager == nil {
+		return fallback
+	}
+	return t.manager.HTTPHandler(fallback)
+}
+
+// Reload : reread manually provided certificates, ACME certificates renew themselves
+func (t *TLS) Reload() error {
+	if t.reloader == nil {
+		return nil
+	}
+	return t.reloader.Reload()
+}
+
+// CertReloader : certificate/key pair that can be swapped while serving
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+}
+
+// NewCertReloader : load the certificate/key pair from disk
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload : reread the certificate/key pair, keeping the old pair on error
+func (r *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// GetCertificate : implement tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
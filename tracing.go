@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName : instrumentation scope of spans created by this api
+const tracerName = "github.com/getmicah/myapp-api"
+
+var tracer = otel.Tracer(tracerName)
+
+// InitTracing : install the W3C trace context propagator and, when an OTLP
+// endpoint is configured, a tracer provider exporting to it. The returned
+// function flushes pending spans.
+func InitTracing(ctx context.Context, c config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	if c.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(c.OTLPEndpoint))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", c.ServiceName),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// TracingMiddleware : continue the caller's trace (traceparent) and span each request
+func TracingMiddleware(rt *Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := rt.Route(r)
+		name := rt.Method(r)
+		if route != "" {
+			name += " " + route
+		}
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("http.route", route),
+			),
+		)
+		defer span.End()
+		if id := RequestID(ctx); id != "" {
+			span.SetAttributes(attribute.String("request.id", id))
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		status := sw.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// TracingTransport : http.RoundTripper spanning each call made to Spotify
+type TracingTransport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip : implement http.RoundTripper
+func (t *TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := spotifyEndpoint(req.URL.Path)
+	ctx, span := tracer.Start(req.Context(), "spotify "+req.Method+" "+endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Host),
+			attribute.String("spotify.endpoint", endpoint),
+		),
+	)
+	defer span.End()
+	res, err := t.Base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return res, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", res.StatusCode))
+	if res.StatusCode >= 400 {
+		span.SetStatus(codes.Error, res.Status)
+	}
+	return res, err
+}
+
+// traceRetry : record a retried attempt on the current Spotify call span
+func traceRetry(req *http.Request, res *http.Response, err error) {
+	attrs := []attribute.KeyValue{}
+	if res != nil {
+		attrs = append(attrs, attribute.Int("http.response.status_code", res.StatusCode))
+	}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error", err.Error()))
+	}
+	trace.SpanFromContext(req.Context()).AddEvent("retry", trace.WithAttributes(attrs...))
+}